@@ -0,0 +1,269 @@
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+// HeaderSize is the size of the tag header, the tag size counts the bytes
+// following it.
+const HeaderSize = 10
+
+const (
+	EncodingISO88591 = 0
+	EncodingUTF16    = 1
+	EncodingUTF16BE  = 2
+	EncodingUTF8     = 3
+)
+
+var ErrInvalidTag = errors.New("invalid id3 tag")
+var ErrInvalidFrame = errors.New("invalid id3 frame")
+
+// Frame is a frame of an ID3v2.4 tag, Data is the frame body as stored in
+// the tag.
+type Frame struct {
+	Id   string
+	Data []byte
+}
+
+// NewTextFrame builds a text information frame like TIT2 with UTF-8 text.
+func NewTextFrame(id string, text string) *Frame {
+	return &Frame{
+		Id:   id,
+		Data: append([]byte{EncodingUTF8}, text...),
+	}
+}
+
+// NewTXXXFrame builds a user defined text frame.
+func NewTXXXFrame(description string, value string) *Frame {
+	data := []byte{EncodingUTF8}
+	data = append(data, description...)
+	data = append(data, 0)
+	data = append(data, value...)
+
+	return &Frame{Id: "TXXX", Data: data}
+}
+
+// NewPRIVFrame builds a private frame, owner is usually a URL or reverse
+// domain identifying the data format.
+func NewPRIVFrame(owner string, data []byte) *Frame {
+	body := make([]byte, 0, len(owner)+1+len(data))
+	body = append(body, owner...)
+	body = append(body, 0)
+	body = append(body, data...)
+
+	return &Frame{Id: "PRIV", Data: body}
+}
+
+// Text decodes the text of a text information frame.
+func (f *Frame) Text() (string, error) {
+	if len(f.Data) < 1 || f.Id == "TXXX" || len(f.Id) != 4 || f.Id[0] != 'T' {
+		return "", ErrInvalidFrame
+	}
+
+	text, _, err := decodeText(f.Data[0], f.Data[1:])
+
+	return text, err
+}
+
+// TXXX decodes description and value of a user defined text frame.
+func (f *Frame) TXXX() (string, string, error) {
+	if f.Id != "TXXX" || len(f.Data) < 1 {
+		return "", "", ErrInvalidFrame
+	}
+
+	description, n, err := decodeText(f.Data[0], f.Data[1:])
+	if err != nil {
+		return "", "", err
+	}
+
+	value, _, err := decodeText(f.Data[0], f.Data[1+n:])
+	if err != nil {
+		return "", "", err
+	}
+
+	return description, value, nil
+}
+
+// PRIV decodes owner and data of a private frame.
+func (f *Frame) PRIV() (string, []byte, error) {
+	if f.Id != "PRIV" {
+		return "", nil, ErrInvalidFrame
+	}
+
+	i := bytes.IndexByte(f.Data, 0)
+	if i < 0 {
+		return "", nil, ErrInvalidFrame
+	}
+
+	return string(f.Data[:i]), f.Data[i+1:], nil
+}
+
+// Encode builds an ID3v2.4 tag holding the frames.
+func Encode(frames ...*Frame) ([]byte, error) {
+	size := 0
+	for _, f := range frames {
+		if !isValidFrameId(f.Id) {
+			return nil, ErrInvalidFrame
+		}
+		size += HeaderSize + len(f.Data)
+	}
+
+	if size > 0x0fffffff {
+		return nil, ErrInvalidTag
+	}
+
+	buf := make([]byte, HeaderSize, HeaderSize+size)
+	copy(buf, "ID3")
+	buf[3] = 4
+	buf[4] = 0
+	buf[5] = 0
+	putSynchsafe(buf[6:], uint32(size))
+
+	for _, f := range frames {
+		header := make([]byte, HeaderSize)
+		copy(header, f.Id)
+		putSynchsafe(header[4:], uint32(len(f.Data)))
+		buf = append(buf, header...)
+		buf = append(buf, f.Data...)
+	}
+
+	return buf, nil
+}
+
+// Decode returns the frames of an ID3v2.3 or ID3v2.4 tag at the start of b.
+// Unsynchronised, compressed and encrypted frames are returned as stored.
+func Decode(b []byte) ([]*Frame, error) {
+	if len(b) < HeaderSize || string(b[:3]) != "ID3" || (b[3] != 3 && b[3] != 4) {
+		return nil, ErrInvalidTag
+	}
+
+	version := b[3]
+	flags := b[5]
+	end := HeaderSize + int(synchsafe(b[6:]))
+	if end > len(b) {
+		return nil, ErrInvalidTag
+	}
+
+	offset := HeaderSize
+	if flags&0x40 != 0 {
+		if offset+4 > end {
+			return nil, ErrInvalidTag
+		}
+		// the v2.3 extended header size excludes its own size field
+		extendedSize := int(binary.BigEndian.Uint32(b[offset:]))
+		if version == 4 {
+			extendedSize = int(synchsafe(b[offset:]))
+		} else {
+			extendedSize += 4
+		}
+		offset += extendedSize
+	}
+
+	frames := make([]*Frame, 0)
+	for offset+HeaderSize <= end {
+		// padding
+		if b[offset] == 0 {
+			break
+		}
+
+		id := string(b[offset : offset+4])
+		size := int(binary.BigEndian.Uint32(b[offset+4:]))
+		if version == 4 {
+			size = int(synchsafe(b[offset+4:]))
+		}
+		offset += HeaderSize
+
+		if !isValidFrameId(id) || offset+size > end {
+			return nil, ErrInvalidFrame
+		}
+
+		frames = append(frames, &Frame{Id: id, Data: b[offset : offset+size]})
+		offset += size
+	}
+
+	return frames, nil
+}
+
+func isValidFrameId(id string) bool {
+	if len(id) != 4 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if (id[i] < 'A' || id[i] > 'Z') && (id[i] < '0' || id[i] > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func putSynchsafe(b []byte, v uint32) {
+	b[0] = uint8(v>>21) & 0x7f
+	b[1] = uint8(v>>14) & 0x7f
+	b[2] = uint8(v>>7) & 0x7f
+	b[3] = uint8(v) & 0x7f
+}
+
+func synchsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// decodeText decodes a string up to its terminator or the end of b and
+// returns how many bytes it used including the terminator.
+func decodeText(encoding uint8, b []byte) (string, int, error) {
+	switch encoding {
+	case EncodingISO88591, EncodingUTF8:
+		n := bytes.IndexByte(b, 0)
+		used := n + 1
+		if n < 0 {
+			n, used = len(b), len(b)
+		}
+
+		if encoding == EncodingUTF8 {
+			return string(b[:n]), used, nil
+		}
+
+		runes := make([]rune, n)
+		for i, c := range b[:n] {
+			runes[i] = rune(c)
+		}
+
+		return string(runes), used, nil
+
+	case EncodingUTF16, EncodingUTF16BE:
+		n := len(b) &^ 1
+		used := n
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				n, used = i, i+2
+				break
+			}
+		}
+
+		units := b[:n]
+		isLittleEndian := false
+		if encoding == EncodingUTF16 && len(units) >= 2 {
+			isLittleEndian = units[0] == 0xff && units[1] == 0xfe
+			if isLittleEndian || units[0] == 0xfe && units[1] == 0xff {
+				units = units[2:]
+			}
+		}
+
+		u := make([]uint16, len(units)/2)
+		for i := range u {
+			if isLittleEndian {
+				u[i] = binary.LittleEndian.Uint16(units[i*2:])
+			} else {
+				u[i] = binary.BigEndian.Uint16(units[i*2:])
+			}
+		}
+
+		return string(utf16.Decode(u)), used, nil
+	}
+
+	return "", 0, ErrInvalidFrame
+}
@@ -0,0 +1,111 @@
+package klv
+
+import (
+	"bytes"
+	"errors"
+)
+
+// KeySize is the size of SMPTE 336M universal label keys.
+const KeySize = 16
+
+var ErrInvalidTriplet = errors.New("invalid klv triplet")
+
+// UASDatalinkLocalSet is the key of the MISB ST 0601 UAS Datalink Local Set.
+var UASDatalinkLocalSet = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x0b, 0x01, 0x01, 0x0e, 0x01, 0x03, 0x01, 0x01, 0x00, 0x00, 0x00}
+
+type Triplet struct {
+	Key   []byte
+	Value []byte
+}
+
+func NewTriplet(key []byte, value []byte) *Triplet {
+	return &Triplet{Key: key, Value: value}
+}
+
+// Encode serializes the triplets with 16 byte keys and BER encoded lengths.
+func Encode(triplets ...*Triplet) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, t := range triplets {
+		if len(t.Key) != KeySize {
+			return nil, ErrInvalidTriplet
+		}
+
+		buf.Write(t.Key)
+		buf.Write(EncodeBERLength(len(t.Value)))
+		buf.Write(t.Value)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode splits b into triplets with 16 byte keys, values refer to b.
+func Decode(b []byte) ([]*Triplet, error) {
+	triplets := make([]*Triplet, 0)
+
+	for len(b) > 0 {
+		if len(b) < KeySize+1 {
+			return nil, ErrInvalidTriplet
+		}
+
+		length, n, err := DecodeBERLength(b[KeySize:])
+		if err != nil {
+			return nil, err
+		}
+
+		start := KeySize + n
+		if length > len(b)-start {
+			return nil, ErrInvalidTriplet
+		}
+
+		triplets = append(triplets, &Triplet{
+			Key:   b[:KeySize],
+			Value: b[start : start+length],
+		})
+		b = b[start+length:]
+	}
+
+	return triplets, nil
+}
+
+// EncodeBERLength uses the short form below 128 and the shortest long form
+// otherwise.
+func EncodeBERLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{uint8(length)}
+	}
+
+	buf := make([]byte, 0, 9)
+	for v := length; v > 0; v >>= 8 {
+		buf = append(buf, uint8(v))
+	}
+	buf = append(buf, 0x80|uint8(len(buf)))
+
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+
+	return buf
+}
+
+// DecodeBERLength returns the length and how many bytes encode it.
+func DecodeBERLength(b []byte) (int, int, error) {
+	if len(b) < 1 {
+		return 0, 0, ErrInvalidTriplet
+	}
+
+	if b[0] < 0x80 {
+		return int(b[0]), 1, nil
+	}
+
+	n := int(b[0] & 0x7f)
+	if n == 0 || n > 4 || len(b) < 1+n {
+		return 0, 0, ErrInvalidTriplet
+	}
+
+	length := 0
+	for _, v := range b[1 : 1+n] {
+		length = length<<8 | int(v)
+	}
+
+	return length, 1 + n, nil
+}
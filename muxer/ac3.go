@@ -0,0 +1,134 @@
+package muxer
+
+import (
+	"mpegts/ts"
+	"slices"
+	"time"
+)
+
+const (
+	// AC3SignallingATSC announces AC-3 and E-AC-3 with their own stream
+	// types as in ATSC A/52.
+	AC3SignallingATSC = iota
+	// AC3SignallingDVB announces them as private data with the AC-3 or
+	// enhanced AC-3 descriptor as in DVB.
+	AC3SignallingDVB
+)
+
+const ac3SamplesPerBlock = 256
+
+var ac3SampleRates = []int64{48000, 44100, 32000}
+
+var eac3ReducedSampleRates = []int64{24000, 22050, 16000}
+
+// ac3Bitrates are the nominal bitrates in kbit/s by frmsizecod / 2.
+var ac3Bitrates = []int64{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+
+// AC3Parser splits an AC-3 or E-AC-3 stream into sync frames and packs
+// them into PES packets lasting up to the configured duration. Dependent
+// substreams stay with the independent frame they extend. Frames get
+// timestamps derived from the sample rate, caller timestamps are followed
+// only when they deviate by more than half a frame. Bitrate reports the
+// rate of the last frame together with its dependent substreams.
+type AC3Parser struct {
+	audioParser
+}
+
+// NewAC3Parser packs frames into PES packets of up to pesDuration, zero
+// writes every frame into a PES of its own.
+func NewAC3Parser(pid uint16, pesDuration time.Duration) *AC3Parser {
+	return &AC3Parser{newAudioParser(pid, pesDuration, 6, parseAC3Header)}
+}
+
+// parseAC3Header validates the syncinfo and bsi at the start of b, bsid
+// tells AC-3 up to 10 from E-AC-3 from 11 to 16.
+func parseAC3Header(b []byte) (*audioFrame, bool) {
+	if len(b) < 6 || b[0] != 0x0b || b[1] != 0x77 {
+		return nil, false
+	}
+
+	bsid := b[5] >> 3
+	switch {
+	case bsid <= 10:
+		return parseAC3SyncFrame(b, bsid)
+	case bsid <= 16:
+		return parseEAC3SyncFrame(b)
+	}
+
+	return nil, false
+}
+
+// parseAC3SyncFrame reads fscod and frmsizecod, bsid 9 and 10 are the half
+// and quarter sample rate variants.
+func parseAC3SyncFrame(b []byte, bsid uint8) (*audioFrame, bool) {
+	fscod := int(b[4] >> 6)
+	frmsizecod := int(b[4] & 0x3f)
+	if fscod >= len(ac3SampleRates) || frmsizecod >= 2*len(ac3Bitrates) {
+		return nil, false
+	}
+
+	sampleRate := ac3SampleRates[fscod]
+	words := ac3Bitrates[frmsizecod/2] * 1000 * 6 * ac3SamplesPerBlock / (sampleRate * 16)
+	if sampleRate == 44100 {
+		words += int64(frmsizecod & 1)
+	}
+
+	return &audioFrame{
+		length:     int(words) * 2,
+		sampleRate: sampleRate >> max(int(bsid)-8, 0),
+		samples:    6 * ac3SamplesPerBlock,
+	}, true
+}
+
+// parseEAC3SyncFrame reads strmtyp, substreamid, frmsiz, fscod and
+// numblkscod. Only independent substream 0 advances time, the frames of
+// further substreams belong to the same period.
+func parseEAC3SyncFrame(b []byte) (*audioFrame, bool) {
+	strmtyp := b[2] >> 6
+	substreamId := b[2] >> 3 & 0x7
+	frmsiz := int(b[2]&0x7)<<8 | int(b[3])
+	fscod := int(b[4] >> 6)
+	numblkscod := int(b[4] >> 4 & 0x3)
+
+	if strmtyp == 3 {
+		return nil, false
+	}
+
+	frame := &audioFrame{length: (frmsiz + 1) * 2}
+	if fscod == 3 {
+		// numblkscod is fscod2 and there are always six blocks
+		if numblkscod == 3 {
+			return nil, false
+		}
+		frame.sampleRate = eac3ReducedSampleRates[numblkscod]
+		numblkscod = 3
+	} else {
+		frame.sampleRate = ac3SampleRates[fscod]
+	}
+
+	if strmtyp == 0 && substreamId == 0 {
+		frame.samples = int64([]int{1, 2, 3, 6}[numblkscod]) * ac3SamplesPerBlock
+	}
+
+	return frame, true
+}
+
+// dvbAC3Signalling turns AC-3 and E-AC-3 streams into private data streams
+// led by the descriptor of their codec unless it is configured.
+func dvbAC3Signalling(stream *StreamMeta, descriptors []*ts.Descriptor) (uint8, []*ts.Descriptor) {
+	var d *ts.Descriptor
+	switch stream.StreamTypeId {
+	case ts.StreamTypeAudioAc3:
+		d = ts.NewAC3Descriptor(&ts.AC3Descriptor{})
+	case ts.StreamTypeAudioEac3:
+		d = ts.NewEnhancedAC3Descriptor(&ts.EnhancedAC3Descriptor{})
+	default:
+		return stream.StreamTypeId, descriptors
+	}
+
+	if !slices.ContainsFunc(descriptors, hasTag(d.DescriptorTag)) {
+		descriptors = append([]*ts.Descriptor{d}, descriptors...)
+	}
+
+	return ts.StreamTypePrivateData, descriptors
+}
@@ -0,0 +1,102 @@
+package muxer
+
+import (
+	"mpegts/ts"
+	"slices"
+	"time"
+)
+
+const adtsSamplesPerFrame = 1024
+
+var adtsSampleRates = []int64{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// ADTSParser splits an AAC ADTS stream into frames and packs them into PES
+// packets lasting up to the configured duration. Frames get timestamps
+// derived from the sample rate, caller timestamps are followed only when
+// they deviate by more than half a frame. Bitrate reports the rate of the
+// last frame.
+type ADTSParser struct {
+	audioParser
+}
+
+// NewADTSParser packs frames into PES packets of up to pesDuration, zero
+// writes every frame into a PES of its own.
+func NewADTSParser(pid uint16, pesDuration time.Duration) *ADTSParser {
+	return &ADTSParser{newAudioParser(pid, pesDuration, 7, parseADTSHeader)}
+}
+
+// parseADTSHeader validates the header at the start of b.
+func parseADTSHeader(b []byte) (*audioFrame, bool) {
+	if len(b) < 7 || b[0] != 0xff || b[1]&0xf6 != 0xf0 {
+		return nil, false
+	}
+
+	samplingIndex := int(b[2] >> 2 & 0x0f)
+	if samplingIndex >= len(adtsSampleRates) {
+		return nil, false
+	}
+
+	headerLength := 7
+	if b[1]&0x01 == 0 {
+		// crc_check follows the header
+		headerLength = 9
+	}
+
+	frame := &audioFrame{
+		length:     int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5,
+		sampleRate: adtsSampleRates[samplingIndex],
+		samples:    int64(b[6]&0x03+1) * adtsSamplesPerFrame,
+	}
+
+	if frame.length <= headerLength {
+		return nil, false
+	}
+
+	return frame, true
+}
+
+// isADTS tells AAC streams in ADTS framing, SAMPLE-AES leaves the headers
+// in the clear.
+func (sm *StreamMeta) isADTS() bool {
+	return sm.StreamTypeId == ts.StreamTypeAudioAac || sm.StreamTypeId == ts.StreamTypeAudioAacEncrypted
+}
+
+// packAAC passes a frame of an AAC stream with PESDuration to the ADTS
+// parser of the stream and returns the PES completed by it.
+func (m *Muxer) packAAC(sp *StreamPacket, stream *StreamMeta) []*StreamPacket {
+	if m.aacPackers == nil {
+		m.aacPackers = make(map[uint16]*ADTSParser)
+	}
+
+	p, exists := m.aacPackers[sp.Pid]
+	if !exists {
+		p = NewADTSParser(sp.Pid, stream.PESDuration)
+		m.aacPackers[sp.Pid] = p
+	}
+
+	pts := sp.Pts
+	if !sp.IsHead {
+		pts = NoPts
+	}
+
+	return p.Parse(sp.Data, pts, NoPts)
+}
+
+// flushAAC writes the PES which are still collecting frames.
+func (m *Muxer) flushAAC() error {
+	pids := make([]uint16, 0, len(m.aacPackers))
+	for pid := range m.aacPackers {
+		pids = append(pids, pid)
+	}
+	slices.Sort(pids)
+
+	for _, pid := range pids {
+		for _, sp := range m.aacPackers[pid].Flush() {
+			if err := m.writeFrame(sp); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,391 @@
+package muxer
+
+import (
+	"bytes"
+	"slices"
+)
+
+var startCode = []byte{0, 0, 0, 1}
+
+// nalUnit is a NAL unit without start code together with the timestamps of
+// the data it started in.
+type nalUnit struct {
+	data []byte
+	pts  int64
+	dts  int64
+}
+
+// annexBReader collects the NAL units of Annex B data arriving in chunks of
+// any size. The first NAL unit starting in a chunk carries the timestamps of
+// the chunk, further ones get NoPts.
+type annexBReader struct {
+	buf      []byte
+	scan     int
+	start    int
+	hasStart bool
+	pts      int64
+	dts      int64
+}
+
+func (r *annexBReader) push(data []byte, pts int64, dts int64) []*nalUnit {
+	r.buf = append(r.buf, data...)
+
+	var units []*nalUnit
+	for {
+		i := bytes.Index(r.buf[r.scan:], startCode[1:])
+		if i < 0 {
+			r.scan = max(len(r.buf)-2, r.scan)
+			break
+		}
+		i += r.scan
+
+		if r.hasStart {
+			if nal := trimZeros(r.buf[r.start:i]); len(nal) > 0 {
+				units = append(units, &nalUnit{data: bytes.Clone(nal), pts: r.pts, dts: r.dts})
+			}
+		}
+
+		r.start = i + 3
+		r.scan = r.start
+		r.hasStart = true
+		r.pts, r.dts = pts, dts
+		pts, dts = NoPts, NoPts
+	}
+
+	// drop what was handed out already
+	if r.hasStart && r.start > 0 {
+		r.buf = append(r.buf[:0], r.buf[r.start:]...)
+		r.scan -= r.start
+		r.start = 0
+	} else if !r.hasStart {
+		r.buf = append(r.buf[:0], r.buf[r.scan:]...)
+		r.scan = 0
+	}
+
+	return units
+}
+
+// flush returns the NAL unit still waiting for the next start code.
+func (r *annexBReader) flush() *nalUnit {
+	defer func() {
+		r.buf = r.buf[:0]
+		r.scan = 0
+		r.start = 0
+		r.hasStart = false
+	}()
+
+	if !r.hasStart {
+		return nil
+	}
+
+	nal := trimZeros(r.buf[r.start:])
+	if len(nal) == 0 {
+		return nil
+	}
+
+	return &nalUnit{data: bytes.Clone(nal), pts: r.pts, dts: r.dts}
+}
+
+// trimZeros removes trailing zero bytes, which belong to the next start code
+// or are trailing_zero_8bits.
+func trimZeros(nal []byte) []byte {
+	end := len(nal)
+	for end > 0 && nal[end-1] == 0 {
+		end--
+	}
+
+	return nal[:end]
+}
+
+// nalSyntax describes the NAL units of a video coding standard.
+type nalSyntax interface {
+	// startsAccessUnit reports whether nal begins a new access unit when
+	// it follows a VCL NAL unit.
+	startsAccessUnit(nal []byte) bool
+	isVCL(nal []byte) bool
+	isRandomAccess(nal []byte) bool
+	isDelimiter(nal []byte) bool
+	// delimiter is the access unit delimiter inserted where missing.
+	delimiter(isRandomAccess bool) []byte
+	// parameterSet returns the kind and id of parameter sets, kinds are
+	// numbered in the order they precede random access points.
+	parameterSet(nal []byte) (int, uint32, bool)
+}
+
+// accessUnitParser groups the NAL units of an Annex B byte stream into
+// access units which start with a delimiter. Random access points are
+// flagged with IsKey and preceded by the last seen parameter sets.
+type accessUnitParser struct {
+	pid           uint16
+	syntax        nalSyntax
+	reader        annexBReader
+	au            []*nalUnit
+	hasVCL        bool
+	parameterSets map[int]map[uint32][]byte
+}
+
+func newAccessUnitParser(pid uint16, syntax nalSyntax) accessUnitParser {
+	return accessUnitParser{
+		pid:           pid,
+		syntax:        syntax,
+		parameterSets: make(map[int]map[uint32][]byte),
+	}
+}
+
+// Parse takes the next chunk of the byte stream and returns the access
+// units completed by it. The timestamps belong to the first access unit
+// starting in data, chunks may split access units and NAL units anywhere.
+func (p *accessUnitParser) Parse(data []byte, pts int64, dts int64) []*StreamPacket {
+	var packets []*StreamPacket
+	for _, nal := range p.reader.push(data, pts, dts) {
+		if sp := p.add(nal); sp != nil {
+			packets = append(packets, sp)
+		}
+	}
+
+	return packets
+}
+
+// Flush returns the last access unit, which has no successor to complete
+// it.
+func (p *accessUnitParser) Flush() []*StreamPacket {
+	var packets []*StreamPacket
+	if nal := p.reader.flush(); nal != nil {
+		if sp := p.add(nal); sp != nil {
+			packets = append(packets, sp)
+		}
+	}
+
+	if sp := p.finish(); sp != nil {
+		packets = append(packets, sp)
+	}
+
+	return packets
+}
+
+// add appends a NAL unit to the current access unit and returns the
+// previous access unit when the NAL unit starts a new one.
+func (p *accessUnitParser) add(nal *nalUnit) *StreamPacket {
+	var sp *StreamPacket
+	if p.hasVCL && p.syntax.startsAccessUnit(nal.data) {
+		sp = p.finish()
+	}
+
+	if p.syntax.isVCL(nal.data) {
+		p.hasVCL = true
+	} else if kind, id, ok := p.syntax.parameterSet(nal.data); ok {
+		if p.parameterSets[kind] == nil {
+			p.parameterSets[kind] = make(map[uint32][]byte)
+		}
+		p.parameterSets[kind][id] = nal.data
+	}
+
+	p.au = append(p.au, nal)
+
+	return sp
+}
+
+func (p *accessUnitParser) finish() *StreamPacket {
+	if len(p.au) == 0 {
+		return nil
+	}
+
+	au := p.au
+	p.au = nil
+	p.hasVCL = false
+
+	hasDelimiter := false
+	isRandomAccess := false
+	hasKind := make(map[int]bool)
+	for _, nal := range au {
+		switch {
+		case p.syntax.isDelimiter(nal.data):
+			hasDelimiter = true
+		case p.syntax.isRandomAccess(nal.data):
+			isRandomAccess = true
+		}
+		if kind, _, ok := p.syntax.parameterSet(nal.data); ok {
+			hasKind[kind] = true
+		}
+	}
+
+	units := make([][]byte, 0, len(au)+4)
+	if !hasDelimiter {
+		units = append(units, p.syntax.delimiter(isRandomAccess))
+	}
+	for _, nal := range au {
+		units = append(units, nal.data)
+	}
+
+	// parameter sets go right behind the delimiter
+	if isRandomAccess {
+		kinds := make([]int, 0, len(p.parameterSets))
+		for kind := range p.parameterSets {
+			if !hasKind[kind] {
+				kinds = append(kinds, kind)
+			}
+		}
+		slices.Sort(kinds)
+
+		var parameterSets [][]byte
+		for _, kind := range kinds {
+			parameterSets = append(parameterSets, sortedValues(p.parameterSets[kind])...)
+		}
+		units = slices.Insert(units, 1, parameterSets...)
+	}
+
+	pts, dts := accessUnitTimestamps(au)
+
+	return &StreamPacket{
+		Data:   writeAnnexB(units),
+		Pid:    p.pid,
+		Pts:    pts,
+		Dts:    dts,
+		IsHead: true,
+		IsKey:  isRandomAccess,
+	}
+}
+
+func sortedValues(m map[uint32][]byte) [][]byte {
+	ids := make([]uint32, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	values := make([][]byte, 0, len(m))
+	for _, id := range ids {
+		values = append(values, m[id])
+	}
+
+	return values
+}
+
+// accessUnitTimestamps returns the timestamps of the first NAL unit of an
+// access unit which has them.
+func accessUnitTimestamps(au []*nalUnit) (int64, int64) {
+	for _, nal := range au {
+		if nal.pts != NoPts {
+			return nal.pts, nal.dts
+		}
+	}
+
+	return NoPts, NoPts
+}
+
+// writeAnnexB joins NAL units with four byte start codes.
+func writeAnnexB(units [][]byte) []byte {
+	size := 0
+	for _, nal := range units {
+		size += len(startCode) + len(nal)
+	}
+
+	buf := make([]byte, 0, size)
+	for _, nal := range units {
+		buf = append(buf, startCode...)
+		buf = append(buf, nal...)
+	}
+
+	return buf
+}
+
+// rbsp removes emulation prevention bytes from the start of a NAL unit.
+func rbsp(nal []byte, limit int) []byte {
+	out := make([]byte, 0, min(len(nal), limit))
+	zeros := 0
+	for _, b := range nal {
+		if len(out) >= limit {
+			break
+		}
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+
+	return out
+}
+
+// RemoveEmulationPrevention returns the RBSP of a NAL unit.
+func RemoveEmulationPrevention(nal []byte) []byte {
+	return rbsp(nal, len(nal))
+}
+
+// AddEmulationPrevention inserts emulation prevention bytes wherever two
+// zero bytes are followed by a byte up to 3 and behind trailing zeros.
+func AddEmulationPrevention(rbsp []byte) []byte {
+	nal := make([]byte, 0, len(rbsp)+len(rbsp)/64)
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			nal = append(nal, 3)
+			zeros = 0
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nal = append(nal, b)
+	}
+
+	// a trailing zero would merge into the next start code
+	if zeros > 0 {
+		nal = append(nal, 3)
+	}
+
+	return nal
+}
+
+// bitReader reads Exp-Golomb coded values of parameter sets.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) bit() (uint32, bool) {
+	if r.pos >= len(r.data)*8 {
+		return 0, false
+	}
+
+	b := uint32(r.data[r.pos/8]>>(7-r.pos%8)) & 1
+	r.pos++
+
+	return b, true
+}
+
+func (r *bitReader) skip(n int) {
+	r.pos += n
+}
+
+// ue reads an unsigned Exp-Golomb value.
+func (r *bitReader) ue() (uint32, bool) {
+	zeros := 0
+	for {
+		b, ok := r.bit()
+		if !ok || zeros > 31 {
+			return 0, false
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+	}
+
+	value := uint32(0)
+	for i := 0; i < zeros; i++ {
+		b, ok := r.bit()
+		if !ok {
+			return 0, false
+		}
+		value = value<<1 | b
+	}
+
+	return 1<<zeros - 1 + value, true
+}
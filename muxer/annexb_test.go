@@ -0,0 +1,27 @@
+package muxer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEmulationPrevention(t *testing.T) {
+	for _, test := range []struct {
+		rbsp []byte
+		nal  []byte
+	}{
+		{[]byte{0x65, 0, 0, 1, 0, 0, 2, 0, 0, 3, 0, 0, 4}, []byte{0x65, 0, 0, 3, 1, 0, 0, 3, 2, 0, 0, 3, 3, 0, 0, 4}},
+		{[]byte{0x65, 0, 0, 0, 0}, []byte{0x65, 0, 0, 3, 0, 0, 3}},
+		// a trailing zero would merge into the next start code
+		{[]byte{0x65, 0, 0}, []byte{0x65, 0, 0, 3}},
+	} {
+		nal := AddEmulationPrevention(test.rbsp)
+		if !bytes.Equal(nal, test.nal) {
+			t.Errorf("add % x:\n got % x\nwant % x", test.rbsp, nal, test.nal)
+		}
+
+		if rbsp := RemoveEmulationPrevention(nal); !bytes.Equal(rbsp, test.rbsp) {
+			t.Errorf("remove % x:\n got % x\nwant % x", nal, rbsp, test.rbsp)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package muxer
+
+import "time"
+
+// audioFrame is what packing needs to know about a frame, samples is zero
+// for frames which extend the previous one like dependent substreams.
+type audioFrame struct {
+	length     int
+	sampleRate int64
+	samples    int64
+}
+
+// audioParser splits a stream of self delimiting audio frames and packs
+// them into PES packets lasting up to a maximum duration. Frames get
+// timestamps derived from the sample count, caller timestamps are followed
+// only when they deviate by more than half a frame.
+type audioParser struct {
+	pid             uint16
+	maxDuration     int64
+	headerLength    int
+	parseHeader     func(b []byte) (*audioFrame, bool)
+	buf             []byte
+	basePts         int64
+	samples         int64
+	sampleRate      int64
+	auLength        int
+	auSamples       int64
+	pes             []byte
+	pesPts          int64
+	pesDuration     int64
+	pesSampleRate   int64
+	hasPendingFrame bool
+}
+
+func newAudioParser(pid uint16, pesDuration time.Duration, headerLength int, parseHeader func(b []byte) (*audioFrame, bool)) audioParser {
+	return audioParser{
+		pid:          pid,
+		maxDuration:  toTsClock(pesDuration),
+		headerLength: headerLength,
+		parseHeader:  parseHeader,
+		basePts:      NoPts,
+	}
+}
+
+// Parse takes the next chunk of the stream and returns the PES packets
+// completed by it. The timestamps belong to the first frame starting in
+// data which advances time, bytes which do not form a valid frame are
+// skipped.
+func (p *audioParser) Parse(data []byte, pts int64, dts int64) []*StreamPacket {
+	chunkStart := len(p.buf)
+	p.buf = append(p.buf, data...)
+
+	var packets []*StreamPacket
+	pos := 0
+	for len(p.buf)-pos >= p.headerLength {
+		frame, ok := p.parseHeader(p.buf[pos:])
+		if !ok {
+			pos++
+			continue
+		}
+
+		if pos+frame.length > len(p.buf) {
+			break
+		}
+
+		framePts := int64(NoPts)
+		if pts != NoPts && pos >= chunkStart && frame.samples > 0 {
+			framePts = pts
+			pts = NoPts
+		}
+
+		if sp := p.addFrame(p.buf[pos:pos+frame.length], frame, framePts); sp != nil {
+			packets = append(packets, sp)
+		}
+		pos += frame.length
+	}
+
+	p.buf = append(p.buf[:0], p.buf[pos:]...)
+
+	return packets
+}
+
+// Flush returns the PES still collecting frames.
+func (p *audioParser) Flush() []*StreamPacket {
+	p.buf = p.buf[:0]
+
+	if sp := p.finish(); sp != nil {
+		return []*StreamPacket{sp}
+	}
+
+	return nil
+}
+
+// Bitrate returns the bitrate in bits per second of the last frame together
+// with the frames extending it, zero before the first frame.
+func (p *audioParser) Bitrate() int64 {
+	if p.auSamples == 0 {
+		return 0
+	}
+
+	return int64(p.auLength) * 8 * p.sampleRate / p.auSamples
+}
+
+func (p *audioParser) addFrame(data []byte, frame *audioFrame, pts int64) *StreamPacket {
+	var sp *StreamPacket
+
+	// frames extending one which was never seen are useless
+	if frame.samples == 0 && p.basePts == NoPts && !p.hasPendingFrame {
+		return nil
+	}
+
+	if p.basePts != NoPts && frame.sampleRate != p.sampleRate {
+		p.basePts += p.samples * 90000 / p.sampleRate
+		p.samples = 0
+	}
+	p.sampleRate = frame.sampleRate
+
+	expected := int64(NoPts)
+	if p.basePts != NoPts {
+		expected = p.basePts + p.samples*90000/p.sampleRate
+	}
+
+	// timestamps continue from the sample count unless the caller jumps
+	duration := frame.samples * 90000 / frame.sampleRate
+	if pts != NoPts && frame.samples > 0 && (expected == NoPts || max(pts-expected, expected-pts) > duration/2) {
+		sp = p.finish()
+		p.basePts = pts
+		p.samples = 0
+		expected = pts
+	}
+
+	if p.hasPendingFrame && frame.samples > 0 && (p.pesDuration+duration > p.maxDuration || frame.sampleRate != p.pesSampleRate) {
+		sp = p.finish()
+	}
+
+	if !p.hasPendingFrame {
+		p.pesPts = expected
+		p.pesSampleRate = frame.sampleRate
+	}
+
+	if frame.samples > 0 {
+		p.auLength = 0
+		p.auSamples = frame.samples
+	}
+	p.auLength += frame.length
+
+	p.pes = append(p.pes, data...)
+	p.pesDuration += duration
+	p.hasPendingFrame = true
+	p.samples += frame.samples
+
+	return sp
+}
+
+func (p *audioParser) finish() *StreamPacket {
+	if !p.hasPendingFrame {
+		return nil
+	}
+
+	sp := &StreamPacket{
+		Data:   p.pes,
+		Pid:    p.pid,
+		Pts:    p.pesPts,
+		Dts:    NoPts,
+		IsHead: true,
+	}
+
+	p.pes = nil
+	p.pesDuration = 0
+	p.hasPendingFrame = false
+
+	return sp
+}
@@ -0,0 +1,85 @@
+package muxer
+
+import (
+	"testing"
+	"time"
+)
+
+// ac3Frame returns an AC-3 sync frame at 48 kHz, frmsizecod 28 is 384 kbit/s.
+func ac3Frame() []byte {
+	b := make([]byte, 1536)
+	copy(b, []byte{0x0b, 0x77, 0, 0, 28, 8 << 3})
+
+	return b
+}
+
+// eac3Frame returns an E-AC-3 sync frame of six blocks at 48 kHz.
+func eac3Frame(strmtyp uint8, length int) []byte {
+	frmsiz := length/2 - 1
+	b := make([]byte, length)
+	copy(b, []byte{0x0b, 0x77, strmtyp<<6 | uint8(frmsiz>>8), uint8(frmsiz), 3 << 4, 16 << 3})
+
+	return b
+}
+
+// adtsFrame returns an ADTS frame of one raw data block at 48 kHz.
+func adtsFrame(length int) []byte {
+	b := make([]byte, length)
+	copy(b, []byte{0xff, 0xf1, 0x4c, 0x80 | byte(length>>11), byte(length >> 3), byte(length<<5) | 0x1f, 0xfc})
+
+	return b
+}
+
+func TestAC3ParserBitrate(t *testing.T) {
+	p := NewAC3Parser(0x100, 0)
+	if p.Bitrate() != 0 {
+		t.Errorf("bitrate %d before the first frame", p.Bitrate())
+	}
+
+	p.Parse(ac3Frame(), 0, NoPts)
+	if p.Bitrate() != 384000 {
+		t.Errorf("bitrate %d, want 384000", p.Bitrate())
+	}
+}
+
+func TestEAC3ParserDependentSubstream(t *testing.T) {
+	p := NewAC3Parser(0x100, 100*time.Millisecond)
+
+	var data []byte
+	for range 4 {
+		data = append(data, eac3Frame(0, 768)...)
+		data = append(data, eac3Frame(1, 256)...)
+	}
+
+	packets := p.Parse(data, 0, NoPts)
+	packets = append(packets, p.Flush()...)
+
+	// 768 and 256 bytes every 1536 samples
+	if p.Bitrate() != 256000 {
+		t.Errorf("bitrate %d, want 256000", p.Bitrate())
+	}
+
+	// 32 ms frames, three fit into 100 ms and dependent substreams stay
+	// with their frame
+	if len(packets) != 2 || len(packets[0].Data) != 3*1024 || len(packets[1].Data) != 1024 {
+		t.Fatalf("%d packets", len(packets))
+	}
+	if packets[0].Pts != 0 || packets[1].Pts != 3*2880 {
+		t.Errorf("pts %d and %d", packets[0].Pts, packets[1].Pts)
+	}
+}
+
+func TestADTSParserBitrate(t *testing.T) {
+	p := NewADTSParser(0x100, 0)
+
+	packets := p.Parse(append(adtsFrame(384), adtsFrame(384)...), 9000, NoPts)
+	if p.Bitrate() != 144000 {
+		t.Errorf("bitrate %d, want 144000", p.Bitrate())
+	}
+
+	// without a PES duration the frame only completes with the next one
+	packets = append(packets, p.Flush()...)
+	if len(packets) != 2 || packets[0].Pts != 9000 || packets[1].Pts != 9000+1920 {
+		t.Errorf("packets %+v", packets)
+	}
+}
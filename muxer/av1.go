@@ -0,0 +1,141 @@
+package muxer
+
+import (
+	"bytes"
+	"errors"
+	"mpegts/ts"
+)
+
+const (
+	obuSequenceHeader    = 1
+	obuTemporalDelimiter = 2
+	obuFrameHeader       = 3
+	obuFrame             = 6
+)
+
+// ErrInvalidOBU rejects AV1 frames whose OBUs in the low overhead bitstream
+// format run past the end of the frame.
+var ErrInvalidOBU = errors.New("invalid obu")
+
+func (sm *StreamMeta) isAV1() bool {
+	return sm.StreamTypeId == ts.StreamTypePrivateData && sm.FormatIdentifier == ts.FormatIdentifierAV01
+}
+
+// wrapAV1 returns a copy of sp with the temporal unit in start code format.
+// Frames in the low overhead bitstream format of IVF, MP4 and Matroska are
+// converted, frames with start codes are taken as they are. Temporal units
+// holding a sequence header and a key frame are flagged with IsKey.
+func wrapAV1(sp *StreamPacket) (*StreamPacket, error) {
+	wrapped := *sp
+
+	if !bytes.HasPrefix(sp.Data, startCode[1:]) {
+		data, err := av1StartCodeFormat(sp.Data)
+		if err != nil {
+			return nil, err
+		}
+		wrapped.Data = data
+	}
+
+	if av1IsKeyTemporalUnit(wrapped.Data) {
+		wrapped.IsKey = true
+	}
+
+	return &wrapped, nil
+}
+
+// av1StartCodeFormat prefixes every OBU with a start code, clears
+// obu_has_size_field and applies emulation prevention. A temporal
+// delimiter is inserted when missing.
+func av1StartCodeFormat(data []byte) ([]byte, error) {
+	buf := make([]byte, 0, len(data)+len(data)/64+16)
+
+	for pos := 0; pos < len(data); {
+		header := data[pos]
+		headerLength := 1
+		if header&0x04 != 0 {
+			headerLength = 2
+		}
+		if pos+headerLength > len(data) {
+			return nil, ErrInvalidOBU
+		}
+
+		size := len(data) - pos - headerLength
+		sizeLength := 0
+		if header&0x02 != 0 {
+			var ok bool
+			if size, sizeLength, ok = readLEB128(data[pos+headerLength:]); !ok {
+				return nil, ErrInvalidOBU
+			}
+		}
+
+		start := pos + headerLength + sizeLength
+		if start+size > len(data) {
+			return nil, ErrInvalidOBU
+		}
+
+		if pos == 0 && header>>3&0xf != obuTemporalDelimiter {
+			buf = append(buf, 0, 0, 1, obuTemporalDelimiter<<3)
+		}
+
+		obu := make([]byte, 0, headerLength+size)
+		obu = append(obu, header&^0x02)
+		obu = append(obu, data[pos+1:pos+headerLength]...)
+		obu = append(obu, data[start:start+size]...)
+
+		buf = append(buf, startCode[1:]...)
+		buf = append(buf, AddEmulationPrevention(obu)...)
+
+		pos = start + size
+	}
+
+	return buf, nil
+}
+
+// av1IsKeyTemporalUnit looks for a sequence header followed by the header
+// of a shown key frame.
+func av1IsKeyTemporalUnit(data []byte) bool {
+	hasSequenceHeader := false
+	reducedStillPicture := false
+
+	for _, obu := range bytes.Split(data, startCode[1:]) {
+		obu = trimZeros(obu)
+		if len(obu) == 0 {
+			continue
+		}
+
+		headerLength := 1
+		if obu[0]&0x04 != 0 {
+			headerLength = 2
+		}
+		if len(obu) <= headerLength {
+			continue
+		}
+		payload := rbsp(obu[headerLength:], 2)
+
+		switch obu[0] >> 3 & 0xf {
+		case obuSequenceHeader:
+			hasSequenceHeader = true
+			reducedStillPicture = payload[0]&0x08 != 0
+		case obuFrameHeader, obuFrame:
+			if !hasSequenceHeader {
+				return false
+			}
+			// show_existing_frame is zero and frame_type is KEY_FRAME
+			return reducedStillPicture || payload[0]&0xe0 == 0
+		}
+	}
+
+	return false
+}
+
+func readLEB128(b []byte) (int, int, bool) {
+	value := 0
+	for i := 0; i < 8 && i < len(b); i++ {
+		value |= int(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return value, i + 1, true
+		}
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,72 @@
+package muxer
+
+const (
+	h264NalSlice = 1
+	h264NalIDR   = 5
+	h264NalSEI   = 6
+	h264NalSPS   = 7
+	h264NalPPS   = 8
+	h264NalAUD   = 9
+)
+
+// H264Parser turns an H.264 Annex B byte stream into access units. Every
+// access unit starts with an access unit delimiter, IDR access units are
+// preceded by the last seen SPS and PPS and flagged with IsKey.
+type H264Parser struct {
+	accessUnitParser
+}
+
+func NewH264Parser(pid uint16) *H264Parser {
+	return &H264Parser{newAccessUnitParser(pid, h264Syntax{})}
+}
+
+type h264Syntax struct{}
+
+// startsAccessUnit follows 7.4.1.2.3, a slice starts a new primary coded
+// picture when its first_mb_in_slice is zero.
+func (h264Syntax) startsAccessUnit(nal []byte) bool {
+	switch nalType := nal[0] & 0x1f; {
+	case nalType == h264NalSlice || nalType == h264NalIDR:
+		return len(nal) > 1 && nal[1]&0x80 != 0
+	case nalType >= h264NalSEI && nalType <= h264NalAUD, nalType >= 14 && nalType <= 18:
+		return true
+	}
+
+	return false
+}
+
+func (h264Syntax) isVCL(nal []byte) bool {
+	nalType := nal[0] & 0x1f
+	return nalType == h264NalSlice || nalType == h264NalIDR
+}
+
+func (h264Syntax) isRandomAccess(nal []byte) bool {
+	return nal[0]&0x1f == h264NalIDR
+}
+
+func (h264Syntax) isDelimiter(nal []byte) bool {
+	return nal[0]&0x1f == h264NalAUD
+}
+
+// delimiter has primary_pic_type 7, which allows any slice type.
+func (h264Syntax) delimiter(bool) []byte {
+	return []byte{h264NalAUD, 0xf0}
+}
+
+// parameterSet reads seq_parameter_set_id behind profile_idc, the
+// constraint flags and level_idc, or pic_parameter_set_id.
+func (h264Syntax) parameterSet(nal []byte) (int, uint32, bool) {
+	switch nal[0] & 0x1f {
+	case h264NalSPS:
+		r := &bitReader{data: rbsp(nal[1:], 16)}
+		r.skip(24)
+		id, ok := r.ue()
+		return 0, id, ok
+	case h264NalPPS:
+		r := &bitReader{data: rbsp(nal[1:], 16)}
+		id, ok := r.ue()
+		return 1, id, ok
+	}
+
+	return 0, 0, false
+}
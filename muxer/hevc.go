@@ -0,0 +1,124 @@
+package muxer
+
+const (
+	hevcNalBLAWLP     = 16
+	hevcNalCRA        = 21
+	hevcNalVPS        = 32
+	hevcNalSPS        = 33
+	hevcNalPPS        = 34
+	hevcNalAUD        = 35
+	hevcNalPrefixSEI  = 39
+	hevcNalReserved41 = 41
+	hevcNalReserved44 = 44
+	hevcNalUnspec48   = 48
+	hevcNalUnspec55   = 55
+)
+
+// HEVCParser turns an HEVC Annex B byte stream into access units. Every
+// access unit starts with an access unit delimiter, IRAP access units (IDR,
+// CRA and BLA) are preceded by the last seen VPS, SPS and PPS and flagged
+// with IsKey.
+type HEVCParser struct {
+	accessUnitParser
+}
+
+func NewHEVCParser(pid uint16) *HEVCParser {
+	return &HEVCParser{newAccessUnitParser(pid, hevcSyntax{})}
+}
+
+type hevcSyntax struct{}
+
+func hevcNalType(nal []byte) uint8 {
+	return nal[0] >> 1 & 0x3f
+}
+
+// startsAccessUnit follows 7.4.2.4.4, a slice segment starts a new picture
+// when first_slice_segment_in_pic_flag is set.
+func (s hevcSyntax) startsAccessUnit(nal []byte) bool {
+	switch nalType := hevcNalType(nal); {
+	case s.isVCL(nal):
+		return len(nal) > 2 && nal[2]&0x80 != 0
+	case nalType >= hevcNalVPS && nalType <= hevcNalAUD, nalType == hevcNalPrefixSEI,
+		nalType >= hevcNalReserved41 && nalType <= hevcNalReserved44,
+		nalType >= hevcNalUnspec48 && nalType <= hevcNalUnspec55:
+		return true
+	}
+
+	return false
+}
+
+func (hevcSyntax) isVCL(nal []byte) bool {
+	return len(nal) > 1 && hevcNalType(nal) < 32
+}
+
+// isRandomAccess reports IRAP pictures, which are BLA, IDR and CRA.
+func (hevcSyntax) isRandomAccess(nal []byte) bool {
+	nalType := hevcNalType(nal)
+	return nalType >= hevcNalBLAWLP && nalType <= hevcNalCRA
+}
+
+func (hevcSyntax) isDelimiter(nal []byte) bool {
+	return hevcNalType(nal) == hevcNalAUD
+}
+
+// delimiter has pic_type 2, which allows any slice type.
+func (hevcSyntax) delimiter(bool) []byte {
+	return []byte{hevcNalAUD << 1, 1, 0x50}
+}
+
+func (hevcSyntax) parameterSet(nal []byte) (int, uint32, bool) {
+	if len(nal) < 3 {
+		return 0, 0, false
+	}
+
+	switch hevcNalType(nal) {
+	case hevcNalVPS:
+		return 0, uint32(nal[2] >> 4), true
+	case hevcNalSPS:
+		// profile_tier_level grows to 98 bytes with sub-layers, read all
+		r := &bitReader{data: RemoveEmulationPrevention(nal[2:])}
+		r.skip(4)
+		maxSubLayersMinus1 := 0
+		for i := 0; i < 3; i++ {
+			b, _ := r.bit()
+			maxSubLayersMinus1 = maxSubLayersMinus1<<1 | int(b)
+		}
+		r.skip(1)
+		skipProfileTierLevel(r, maxSubLayersMinus1)
+		id, ok := r.ue()
+		return 1, id, ok
+	case hevcNalPPS:
+		r := &bitReader{data: rbsp(nal[2:], 16)}
+		id, ok := r.ue()
+		return 2, id, ok
+	}
+
+	return 0, 0, false
+}
+
+// skipProfileTierLevel skips profile_tier_level with profilePresentFlag set.
+func skipProfileTierLevel(r *bitReader, maxSubLayersMinus1 int) {
+	// general profile, tier and level
+	r.skip(96)
+
+	profilePresent := make([]bool, maxSubLayersMinus1)
+	levelPresent := make([]bool, maxSubLayersMinus1)
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		b, _ := r.bit()
+		profilePresent[i] = b == 1
+		b, _ = r.bit()
+		levelPresent[i] = b == 1
+	}
+	if maxSubLayersMinus1 > 0 {
+		r.skip(2 * (8 - maxSubLayersMinus1))
+	}
+
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if profilePresent[i] {
+			r.skip(88)
+		}
+		if levelPresent[i] {
+			r.skip(8)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package muxer
+
+import (
+	"bytes"
+	"testing"
+)
+
+// hevcSPS returns an SPS with six sub-layers which all signal profile and
+// level, pushing sps_seq_parameter_set_id 3 behind byte 87.
+func hevcSPS() []byte {
+	sps := []byte{hevcNalSPS << 1, 1, 6<<1 | 1}
+	sps = append(sps, bytes.Repeat([]byte{0x11}, 12)...)
+	sps = append(sps, 0xff, 0xf0)
+	sps = append(sps, bytes.Repeat([]byte{0x11}, 6*12)...)
+
+	// ue(3) followed by filler
+	return append(sps, 0x27, 0x80)
+}
+
+func TestHEVCParameterSetSubLayers(t *testing.T) {
+	kind, id, ok := hevcSyntax{}.parameterSet(hevcSPS())
+	if !ok || kind != 1 || id != 3 {
+		t.Errorf("kind %d id %d ok %v", kind, id, ok)
+	}
+}
+
+func TestHEVCParserRepeatsParameterSets(t *testing.T) {
+	vps := []byte{hevcNalVPS << 1, 1, 0x0c, 0x01}
+	sps := hevcSPS()
+	pps := []byte{hevcNalPPS << 1, 1, 0xc1}
+	idr := []byte{19 << 1, 1, 0x80, 0x42}
+	trail := []byte{1 << 1, 1, 0x80, 0x42}
+
+	p := NewHEVCParser(0x100)
+	packets := p.Parse(writeAnnexB([][]byte{vps, sps, pps, idr, trail, idr}), 0, NoPts)
+	packets = append(packets, p.Flush()...)
+	if len(packets) != 3 {
+		t.Fatalf("%d access units", len(packets))
+	}
+
+	want := writeAnnexB([][]byte{{hevcNalAUD << 1, 1, 0x50}, vps, sps, pps, idr})
+	if last := packets[2]; !last.IsKey || !bytes.Equal(last.Data, want) {
+		t.Errorf("access unit % x, want % x", last.Data, want)
+	}
+}
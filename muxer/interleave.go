@@ -0,0 +1,91 @@
+package muxer
+
+import (
+	"math"
+	"time"
+)
+
+type streamQueue struct {
+	frames   []*queuedFrame
+	lastDts  int64
+	lastSeen time.Time
+}
+
+type queuedFrame struct {
+	sp  *StreamPacket
+	dts int64
+	seq uint64
+}
+
+// enqueue appends a packet to the queue of its stream, continuation and
+// untimed packets inherit the DTS of the preceding head packet.
+func (m *Muxer) enqueue(sp *StreamPacket) {
+	q := m.queues[sp.Pid]
+	if sp.IsHead && sp.Pts != NoPts {
+		q.lastDts = sp.DecodingTs()
+	}
+	q.lastSeen = time.Now()
+
+	q.frames = append(q.frames, &queuedFrame{
+		sp:  sp,
+		dts: q.lastDts,
+		seq: m.queueSeq,
+	})
+	m.queueSeq++
+}
+
+// interleave writes queued frames in DTS order as long as they are ready,
+// all of them when flush is set.
+func (m *Muxer) interleave(flush bool) error {
+	for {
+		q := m.nextQueue(flush)
+		if q == nil {
+			return nil
+		}
+
+		f := q.frames[0]
+		q.frames[0] = nil
+		q.frames = q.frames[1:]
+
+		if err := m.writeStreamPacket(f.sp); err != nil {
+			return err
+		}
+	}
+}
+
+// nextQueue returns the queue holding the frame with the lowest DTS when
+// every stream which is not stalled has a frame queued or the queued frames
+// span more than the max interleave delta.
+func (m *Muxer) nextQueue(flush bool) *streamQueue {
+	var next *streamQueue
+	maxDts := int64(math.MinInt64)
+	ready := true
+	now := time.Now()
+
+	for _, q := range m.queues {
+		if len(q.frames) == 0 {
+			if m.maxWait == 0 || now.Sub(q.lastSeen) <= m.maxWait {
+				ready = false
+			}
+			continue
+		}
+
+		head := q.frames[0]
+		if next == nil || head.dts < next.frames[0].dts ||
+			(head.dts == next.frames[0].dts && head.seq < next.frames[0].seq) {
+			next = q
+		}
+
+		maxDts = max(maxDts, q.frames[len(q.frames)-1].dts)
+	}
+
+	if next == nil {
+		return nil
+	}
+
+	if flush || ready || maxDts-next.frames[0].dts > m.interleaveDelta {
+		return next
+	}
+
+	return nil
+}
@@ -2,9 +2,13 @@ package muxer
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"mpegts/id3"
+	"mpegts/klv"
 	"mpegts/ts"
 	"os"
+	"time"
 )
 
 const JmDefaultVideoStreamId = 224
@@ -31,6 +35,11 @@ const (
 	JmStreamTypeAudioMpeg2
 	JmStreamTypeAudioTrueHD
 	JmStreamTypeAudioEac3
+	JmStreamTypeSCTE35
+	JmStreamTypeMetadata
+	JmStreamTypePrivateData
+	JmStreamTypeVideoAV1
+	JmStreamTypeVideoVvc
 )
 
 type jmState uint8
@@ -41,20 +50,41 @@ const (
 	jmClosed
 )
 
+// elementaryParser splits an elementary stream into frames.
+type elementaryParser interface {
+	Parse(data []byte, pts int64, dts int64) []*StreamPacket
+	Flush() []*StreamPacket
+}
+
 type JavaAdapter struct {
-	destPath string
-	pmtPid   int
-	pcrPid   uint16
-	state    jmState
-	streams  []*StreamMeta
-	ch       chan *StreamPacket
-	closeCh  <-chan struct{}
+	destPath          string
+	transportStreamId int
+	programNumber     int
+	service           *ServiceMeta
+	pmtPid            int
+	pcrPid            uint16
+	state             jmState
+	streams           []*StreamMeta
+	psiIntervalMs     int
+	psiPacketInterval int
+	pcrIntervalMs     int
+	pcrOffsetMs       int
+	muxRate           int
+	interleaveDeltaMs int
+	maxWaitMs         int
+	audioPESDuration  int
+	ac3Signalling     int
+	parsers           map[uint16]elementaryParser
+	ch                chan *StreamPacket
+	handle            *Handle
+	cancel            context.CancelFunc
 }
 
 func NewJavaAdapter(destPath string, pmtPid int) *JavaAdapter {
 	return &JavaAdapter{
 		destPath: destPath,
 		streams:  make([]*StreamMeta, 0),
+		parsers:  make(map[uint16]elementaryParser),
 		ch:       make(chan *StreamPacket, 1024),
 		pmtPid:   pmtPid,
 		state:    jmReady,
@@ -70,21 +100,266 @@ func (j *JavaAdapter) AddStream(pid int, streamId int, streamTypeId int) error {
 		return errors.New("invalid pid")
 	}
 
-	if !ts.IsValidStreamId(uint8(streamId)) {
-		return errors.New("invalid stream id")
-	}
-
 	_streamTypeId, err := j.toValidStreamType(streamTypeId)
 	if err != nil {
 		return err
 	}
 
+	if !ts.IsValidStreamId(uint8(streamId)) && _streamTypeId != ts.StreamTypeSCTE35 {
+		return errors.New("invalid stream id")
+	}
+
+	if streamTypeId == JmStreamTypeVideoAV1 && uint8(streamId) != ts.StreamIdPrivateStream1 {
+		return errors.New("invalid stream id")
+	}
+
 	j.streams = append(j.streams, &StreamMeta{
 		Pid:          uint16(pid),
 		StreamId:     uint8(streamId),
 		StreamTypeId: _streamTypeId,
 	})
 
+	if streamTypeId == JmStreamTypeVideoAV1 {
+		j.streams[len(j.streams)-1].FormatIdentifier = ts.FormatIdentifierAV01
+	}
+
+	return nil
+}
+
+// AddOpusStream adds an Opus stream with the given number of channels,
+// frames written to it are single Opus packets.
+func (j *JavaAdapter) AddOpusStream(pid int, channels int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if uint16(pid) == 0 {
+		return errors.New("invalid pid")
+	}
+
+	if channels < 1 || channels > 8 {
+		return errors.New("invalid channel count")
+	}
+
+	j.streams = append(j.streams, &StreamMeta{
+		Pid:              uint16(pid),
+		StreamId:         ts.StreamIdPrivateStream1,
+		StreamTypeId:     ts.StreamTypePrivateData,
+		FormatIdentifier: ts.FormatIdentifierOpus,
+		Descriptors:      []*ts.Descriptor{ts.NewOpusDescriptor(uint8(channels))},
+	})
+
+	return nil
+}
+
+// SetAV1Config announces the AV1CodecConfigurationRecord of an AV1 stream
+// in its AV1 video descriptor.
+func (j *JavaAdapter) SetAV1Config(pid int, config []byte) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	descriptor, err := ts.NewAV1VideoDescriptorFromConfig(config)
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range j.streams {
+		if stream.Pid == uint16(pid) && stream.FormatIdentifier == ts.FormatIdentifierAV01 {
+			stream.Descriptors = append(stream.Descriptors, descriptor)
+			return nil
+		}
+	}
+
+	return errors.New("invalid pid")
+}
+
+func (j *JavaAdapter) SetAccessUnitAligned(pid int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	for _, stream := range j.streams {
+		if stream.Pid == uint16(pid) {
+			stream.AccessUnitAligned = true
+			return nil
+		}
+	}
+
+	return errors.New("invalid pid")
+}
+
+// SetStreamFormat sets the four character registered format of a metadata
+// or private data stream, like KLVA for KLV.
+func (j *JavaAdapter) SetStreamFormat(pid int, format string) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if len(format) != 4 {
+		return errors.New("invalid format")
+	}
+
+	for _, stream := range j.streams {
+		if stream.Pid == uint16(pid) {
+			stream.FormatIdentifier = binary.BigEndian.Uint32([]byte(format))
+			return nil
+		}
+	}
+
+	return errors.New("invalid pid")
+}
+
+func (j *JavaAdapter) SetStreamLanguage(pid int, language string) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	for _, stream := range j.streams {
+		if stream.Pid == uint16(pid) {
+			stream.Descriptors = append(stream.Descriptors, ts.NewISO639LanguageDescriptor(&ts.ISO639Language{
+				Code: language,
+			}))
+			return nil
+		}
+	}
+
+	return errors.New("invalid pid")
+}
+
+func (j *JavaAdapter) SetTransportStreamId(transportStreamId int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if transportStreamId < 0 || transportStreamId > 0xffff {
+		return errors.New("invalid transport stream id")
+	}
+
+	j.transportStreamId = transportStreamId
+
+	return nil
+}
+
+func (j *JavaAdapter) SetProgramNumber(programNumber int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if programNumber <= 0 || programNumber > 0xffff {
+		return errors.New("invalid program number")
+	}
+
+	j.programNumber = programNumber
+
+	return nil
+}
+
+func (j *JavaAdapter) SetService(serviceType int, providerName string, serviceName string) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if serviceType <= 0 || serviceType > 0xff {
+		return errors.New("invalid service type")
+	}
+
+	j.service = &ServiceMeta{
+		ServiceType:  uint8(serviceType),
+		ProviderName: providerName,
+		ServiceName:  serviceName,
+	}
+
+	return nil
+}
+
+func (j *JavaAdapter) SetPSIInterval(intervalMs int, packetInterval int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if intervalMs < 0 || packetInterval < 0 {
+		return errors.New("invalid psi interval")
+	}
+
+	j.psiIntervalMs = intervalMs
+	j.psiPacketInterval = packetInterval
+
+	return nil
+}
+
+func (j *JavaAdapter) SetPCRTiming(intervalMs int, offsetMs int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if intervalMs < 0 || offsetMs < 0 {
+		return errors.New("invalid pcr timing")
+	}
+
+	j.pcrIntervalMs = intervalMs
+	j.pcrOffsetMs = offsetMs
+
+	return nil
+}
+
+func (j *JavaAdapter) SetMuxRate(bitrate int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if bitrate < 0 {
+		return errors.New("invalid mux rate")
+	}
+
+	j.muxRate = bitrate
+
+	return nil
+}
+
+func (j *JavaAdapter) SetInterleaving(maxDeltaMs int, maxWaitMs int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if maxDeltaMs < 0 || maxWaitMs < 0 {
+		return errors.New("invalid interleaving")
+	}
+
+	j.interleaveDeltaMs = maxDeltaMs
+	j.maxWaitMs = maxWaitMs
+
+	return nil
+}
+
+// SetAudioPESDuration lets WriteElementaryStream pack AAC, AC-3 and E-AC-3
+// frames into PES packets lasting up to durationMs.
+func (j *JavaAdapter) SetAudioPESDuration(durationMs int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if durationMs < 0 {
+		return errors.New("invalid duration")
+	}
+
+	j.audioPESDuration = durationMs
+
+	return nil
+}
+
+// SetAC3Signalling selects AC3SignallingATSC or AC3SignallingDVB.
+func (j *JavaAdapter) SetAC3Signalling(signalling int) error {
+	if j.state != jmReady {
+		return errors.New("unavailable for current state")
+	}
+
+	if signalling != AC3SignallingATSC && signalling != AC3SignallingDVB {
+		return errors.New("invalid ac3 signalling")
+	}
+
+	j.ac3Signalling = signalling
+
 	return nil
 }
 
@@ -104,8 +379,10 @@ func (j *JavaAdapter) Open() error {
 
 	if j.pcrPid == 0 {
 		for _, stream := range j.streams {
-			j.pcrPid = stream.Pid
-			break
+			if !stream.isSection() {
+				j.pcrPid = stream.Pid
+				break
+			}
 		}
 	}
 
@@ -114,10 +391,34 @@ func (j *JavaAdapter) Open() error {
 		return err
 	}
 
-	j.closeCh, err = Run(context.Background(), f, uint16(j.pmtPid), j.pcrPid, j.streams, j.ch)
+	var services []*ServiceMeta
+	if j.service != nil {
+		services = append(services, j.service)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j.handle, err = Run(ctx, f, Config{
+		TransportStreamId:  uint16(j.transportStreamId),
+		ProgramNumber:      uint16(j.programNumber),
+		PmtPid:             uint16(j.pmtPid),
+		PcrPid:             j.pcrPid,
+		Streams:            j.streams,
+		Services:           services,
+		PSIInterval:        time.Duration(j.psiIntervalMs) * time.Millisecond,
+		PSIPacketInterval:  j.psiPacketInterval,
+		PCRInterval:        time.Duration(j.pcrIntervalMs) * time.Millisecond,
+		PCROffset:          time.Duration(j.pcrOffsetMs) * time.Millisecond,
+		MuxRate:            int64(j.muxRate),
+		MaxInterleaveDelta: time.Duration(j.interleaveDeltaMs) * time.Millisecond,
+		MaxWait:            time.Duration(j.maxWaitMs) * time.Millisecond,
+		AC3Signalling:      j.ac3Signalling,
+	}, j.ch)
 	if err != nil {
+		cancel()
+		_ = f.Close()
 		return err
 	}
+	j.cancel = cancel
 
 	j.state = jmOpened
 
@@ -129,37 +430,211 @@ func (j *JavaAdapter) Close() error {
 		return errors.New("unavailable for current state")
 	}
 
+	for _, parser := range j.parsers {
+		for _, sp := range parser.Flush() {
+			if err := j.send(sp); err != nil {
+				break
+			}
+		}
+	}
+
 	j.state = jmClosed
 	close(j.ch)
-	<-j.closeCh
+	<-j.handle.Done()
+	j.cancel()
+
+	return j.handle.Err()
+}
+
+func (j *JavaAdapter) Abort() error {
+	if j.state != jmOpened {
+		return errors.New("unavailable for current state")
+	}
+
+	j.state = jmClosed
+	j.cancel()
+	<-j.handle.Done()
+
+	if err := j.handle.Err(); !errors.Is(err, context.Canceled) {
+		return err
+	}
 
 	return nil
 }
 
 func (j *JavaAdapter) Write(pid int, b []byte, pts int64, isHead bool) error {
+	return j.WriteWithDts(pid, b, pts, NoPts, isHead)
+}
+
+func (j *JavaAdapter) WriteWithDts(pid int, b []byte, pts int64, dts int64, isHead bool) error {
+	return j.WriteFrame(pid, b, pts, dts, isHead, false, false)
+}
+
+func (j *JavaAdapter) WriteFrame(pid int, b []byte, pts int64, dts int64, isHead bool, isKey bool, isPriority bool) error {
 	if j.state != jmOpened {
 		return errors.New("unavailable for current state")
 	}
 
+	if err := j.handle.Err(); err != nil {
+		return err
+	}
+
+	for _, stream := range j.streams {
+		if stream.Pid == uint16(pid) && stream.isSection() {
+			return ErrSectionStream
+		}
+	}
+
 	nBuf := make([]byte, len(b))
 	copy(nBuf, b)
 
-	j.ch <- &StreamPacket{
-		Data:   nBuf,
-		Pid:    uint16(pid),
-		Pts:    pts,
-		IsHead: isHead,
+	return j.send(&StreamPacket{
+		Data:       nBuf,
+		Pid:        uint16(pid),
+		Pts:        pts,
+		Dts:        dts,
+		IsHead:     isHead,
+		IsKey:      isKey,
+		IsPriority: isPriority,
+	})
+}
+
+// WriteElementaryStream passes raw elementary stream data of any size to a
+// parser which splits it into frames. H.264, HEVC and VVC Annex B, AAC
+// ADTS, AC-3 and E-AC-3 are supported. The timestamps belong to the first
+// frame starting in b.
+func (j *JavaAdapter) WriteElementaryStream(pid int, b []byte, pts int64, dts int64) error {
+	if j.state != jmOpened {
+		return errors.New("unavailable for current state")
+	}
+
+	if err := j.handle.Err(); err != nil {
+		return err
+	}
+
+	parser, exists := j.parsers[uint16(pid)]
+	if !exists {
+		for _, stream := range j.streams {
+			if stream.Pid == uint16(pid) {
+				parser = j.newElementaryParser(stream)
+				break
+			}
+		}
+
+		if parser == nil {
+			return errors.New("no parser for stream")
+		}
+		j.parsers[uint16(pid)] = parser
+	}
+
+	for _, sp := range parser.Parse(b, pts, dts) {
+		if err := j.send(sp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *JavaAdapter) newElementaryParser(stream *StreamMeta) elementaryParser {
+	switch stream.StreamTypeId {
+	case ts.StreamTypeVideoH264:
+		return NewH264Parser(stream.Pid)
+	case ts.StreamTypeVideoHevc:
+		return NewHEVCParser(stream.Pid)
+	case ts.StreamTypeVideoVvc:
+		return NewVVCParser(stream.Pid)
+	case ts.StreamTypeAudioAac:
+		return NewADTSParser(stream.Pid, time.Duration(j.audioPESDuration)*time.Millisecond)
+	case ts.StreamTypeAudioAc3, ts.StreamTypeAudioEac3:
+		return NewAC3Parser(stream.Pid, time.Duration(j.audioPESDuration)*time.Millisecond)
 	}
 
 	return nil
 }
 
+func (j *JavaAdapter) send(sp *StreamPacket) error {
+	select {
+	case j.ch <- sp:
+		return nil
+	case <-j.handle.Done():
+		return j.handle.Err()
+	}
+}
+
+// WriteMetadataText writes a timed ID3 TXXX frame to the metadata stream pid.
+func (j *JavaAdapter) WriteMetadataText(pid int, pts int64, description string, value string) error {
+	tag, err := id3.Encode(id3.NewTXXXFrame(description, value))
+	if err != nil {
+		return err
+	}
+
+	return j.WriteFrame(pid, tag, pts, NoPts, true, false, false)
+}
+
+// WriteMetadataPrivate writes a timed ID3 PRIV frame to the metadata stream
+// pid.
+func (j *JavaAdapter) WriteMetadataPrivate(pid int, pts int64, owner string, data []byte) error {
+	tag, err := id3.Encode(id3.NewPRIVFrame(owner, data))
+	if err != nil {
+		return err
+	}
+
+	return j.WriteFrame(pid, tag, pts, NoPts, true, false, false)
+}
+
+// WriteKLV writes a single KLV triplet to the KLV stream pid.
+func (j *JavaAdapter) WriteKLV(pid int, pts int64, key []byte, value []byte) error {
+	data, err := klv.Encode(klv.NewTriplet(key, value))
+	if err != nil {
+		return err
+	}
+
+	// rejected here as the muxer goroutine only counts rejected frames
+	for _, stream := range j.streams {
+		if stream.Pid == uint16(pid) && stream.isSyncKLV() && len(data) > 0xffff {
+			return ErrMetadataTooLarge
+		}
+	}
+
+	return j.WriteFrame(pid, data, pts, NoPts, true, false, false)
+}
+
+// ScheduleSpliceInsert sends a SCTE-35 splice_insert on pid once the muxer
+// reaches sendPts. The splice happens at splicePts, NoPts splices
+// immediately, and a positive breakDuration returns automatically.
+func (j *JavaAdapter) ScheduleSpliceInsert(pid int, eventId int, isOut bool, splicePts int64, breakDuration int64, sendPts int64) error {
+	if j.state != jmOpened {
+		return errors.New("unavailable for current state")
+	}
+
+	insert := &ts.SpliceInsert{
+		SpliceEventId:         uint32(eventId),
+		OutOfNetworkIndicator: isOut,
+		ProgramSpliceFlag:     true,
+		SpliceImmediateFlag:   splicePts == NoPts,
+	}
+
+	if splicePts != NoPts {
+		insert.SpliceTime = &ts.SpliceTime{TimeSpecifiedFlag: true, PtsTime: uint64(splicePts) & 0x1ffffffff}
+	}
+
+	if breakDuration > 0 {
+		insert.DurationFlag = true
+		insert.BreakDuration = &ts.BreakDuration{AutoReturn: true, Duration: uint64(breakDuration) & 0x1ffffffff}
+	}
+
+	return j.handle.ScheduleCue(uint16(pid), sendPts, ts.NewSpliceInfoSection(insert))
+}
+
 func (j *JavaAdapter) toValidStreamType(streamType int) (uint8, error) {
 	switch streamType {
 	case JmStreamTypeVideoH264:
 		return ts.StreamTypeVideoH264, nil
 	case JmStreamTypeVideoHevc:
 		return ts.StreamTypeVideoHevc, nil
+	case JmStreamTypeVideoVvc:
+		return ts.StreamTypeVideoVvc, nil
 	case JmStreamTypeVideoMpeg1:
 		return ts.StreamTypeVideoMpeg1, nil
 	case JmStreamTypeVideoMpeg2:
@@ -189,6 +664,12 @@ func (j *JavaAdapter) toValidStreamType(streamType int) (uint8, error) {
 		return ts.StreamTypeAudioTrueHD, nil
 	case JmStreamTypeAudioEac3:
 		return ts.StreamTypeAudioEac3, nil
+	case JmStreamTypeSCTE35:
+		return ts.StreamTypeSCTE35, nil
+	case JmStreamTypeMetadata:
+		return ts.StreamTypeMetadata, nil
+	case JmStreamTypePrivateData, JmStreamTypeVideoAV1:
+		return ts.StreamTypePrivateData, nil
 	default:
 		return 0, errors.New("invalid stream type")
 	}
@@ -0,0 +1,97 @@
+package muxer
+
+import (
+	"errors"
+	"mpegts/id3"
+	"mpegts/klv"
+	"mpegts/ts"
+	"slices"
+)
+
+// ErrMetadataTooLarge rejects synchronous KLV frames which do not fit into
+// the 16 bit length of a metadata AU cell.
+var ErrMetadataTooLarge = errors.New("metadata access unit too large")
+
+// WriteMetadata writes an ID3 tag holding frames to the timed metadata
+// stream pid, players raise the frames as events when playback reaches pts.
+func (m *Muxer) WriteMetadata(pid uint16, pts int64, frames ...*id3.Frame) error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	stream, exists := m.streams[pid]
+	if !exists || stream.StreamTypeId != ts.StreamTypeMetadata || stream.FormatIdentifier != ts.FormatIdentifierID3 {
+		return ErrUnknownStream
+	}
+
+	tag, err := id3.Encode(frames...)
+	if err != nil {
+		return err
+	}
+
+	return m.WriteFrame(&StreamPacket{
+		Data:   tag,
+		Pid:    pid,
+		Pts:    pts,
+		Dts:    NoPts,
+		IsHead: true,
+	})
+}
+
+// WriteKLV writes KLV triplets to the KLV stream pid, synchronous streams
+// present them at pts while asynchronous streams usually pass NoPts.
+func (m *Muxer) WriteKLV(pid uint16, pts int64, triplets ...*klv.Triplet) error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	stream, exists := m.streams[pid]
+	if !exists || stream.FormatIdentifier != ts.FormatIdentifierKLVA {
+		return ErrUnknownStream
+	}
+
+	data, err := klv.Encode(triplets...)
+	if err != nil {
+		return err
+	}
+
+	return m.WriteFrame(&StreamPacket{
+		Data:   data,
+		Pid:    pid,
+		Pts:    pts,
+		Dts:    NoPts,
+		IsHead: true,
+	})
+}
+
+// wrapAUCell returns a copy of sp whose data is wrapped into a metadata AU
+// cell, which synchronous KLV requires. Every frame becomes a cell of its
+// own, continuation frames add cells to the PES of the head frame.
+func (m *Muxer) wrapAUCell(sp *StreamPacket, stream *StreamMeta) (*StreamPacket, error) {
+	if len(sp.Data) > 0xffff {
+		return nil, ErrMetadataTooLarge
+	}
+
+	if m.auSequences == nil {
+		m.auSequences = make(map[uint16]uint8)
+	}
+
+	cell := &ts.MetadataAUCell{
+		MetadataServiceId:      uint8(slices.Index(m.streamPrograms[sp.Pid].metadataStreams(), stream)),
+		SequenceNumber:         m.auSequences[sp.Pid],
+		CellFragmentIndication: ts.CellFragmentComplete,
+		RandomAccessIndicator:  true,
+		Reserved:               0xf,
+		Data:                   sp.Data,
+	}
+	m.auSequences[sp.Pid]++
+
+	wrapped := *sp
+	wrapped.Data = cell.Encode()
+
+	return &wrapped, nil
+}
+
+func (sm *StreamMeta) isSyncKLV() bool {
+	return sm.StreamTypeId == ts.StreamTypeMetadata && sm.FormatIdentifier == ts.FormatIdentifierKLVA
+}
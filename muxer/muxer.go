@@ -1,166 +1,1235 @@
 package muxer
 
 import (
+	"bufio"
 	"bytes"
-	"context"
 	"errors"
 	"io"
 	"mpegts/ts"
+	"slices"
+	"sync/atomic"
+	"time"
 )
 
+var ErrUnknownStream = errors.New("unknown stream")
+var ErrClosed = errors.New("muxer closed")
+
+// ErrSectionStream rejects frames for SCTE-35 streams, whose sections are
+// sent by ScheduleCue.
+var ErrSectionStream = errors.New("stream carries sections")
+
+// Muxer writes TS packets of the frames to the destination in the calling
+// goroutine, it is not safe for concurrent use.
 type Muxer struct {
-	pmtPid      uint16
-	pcrPid      uint16
-	destination io.WriteCloser
-	pidCounter  map[uint16]uint8
-	streams     map[uint16]*StreamMeta
-	closeCh     chan struct{}
+	transportStreamId uint16
+	patVersion        uint8
+	originalNetworkId uint16
+	services          []*ServiceMeta
+	sdtVersion        uint8
+	nitPid            uint16
+	destination       io.WriteCloser
+	output            *bufio.Writer
+	pidCounter        map[uint16]uint8
+	programs          []*program
+	streams           map[uint16]*StreamMeta
+	streamPrograms    map[uint16]*program
+	err               error
+	closed            bool
+	overflows         atomic.Uint64
+	interleaveDelta   int64
+	maxWait           time.Duration
+	queues            map[uint16]*streamQueue
+	queueSeq          uint64
+	cues              []*cue
+	auSequences       map[uint16]uint8
+	aacPackers        map[uint16]*ADTSParser
+	splitter          Splitter
+	psiInterval       int64
+	psiPacketInterval int
+	psiClock          int64
+	packetsSincePSI   int
+	clock             int64
+	pcrInterval       int64
+	pcrOffset         int64
+	muxRate           int64
+	ac3Signalling     int
+	packetCount       int64
+	pcrBase           int64
+	hasPCRBase        bool
+}
+
+type program struct {
+	number       uint16
+	pmtPid       uint16
+	pcrPid       uint16
+	descriptors  []*ts.Descriptor
+	streams      []*StreamMeta
+	version      uint8
+	pcrClock     int64
+	lastPCR      int64
+	lastPCRClock int64
+	hasPCR       bool
+}
+
+type Config struct {
+	// TransportStreamId is announced in PAT, DefaultTransportStreamId is
+	// used when zero.
+	TransportStreamId uint16
+	// ProgramNumber, PmtPid and PcrPid describe the single program when
+	// Programs is empty, ProgramNumber defaults to 1.
+	ProgramNumber uint16
+	PmtPid        uint16
+	PcrPid        uint16
+	Streams       []*StreamMeta
+	// VersionNumber is the initial version_number of PAT and PMT, it is
+	// incremented modulo 32 whenever a table changes.
+	VersionNumber uint8
+	// Programs lists the programs of a multi program transport stream,
+	// streams are assigned by StreamMeta.ProgramNumber.
+	Programs []*ProgramMeta
+	// ProgramDescriptors go to program_info of the single program when
+	// Programs is empty.
+	ProgramDescriptors []*ts.Descriptor
+	// NitPid is announced as network PID in PAT when not zero.
+	NitPid uint16
+	// Services are announced in a DVB SDT sent together with PAT and PMT,
+	// no SDT is sent when empty.
+	Services []*ServiceMeta
+	// OriginalNetworkId is announced in SDT, DefaultOriginalNetworkId is
+	// used when zero.
+	OriginalNetworkId uint16
+	// PSIInterval is the maximum stream time between two PAT/PMT
+	// repetitions, zero disables time based repetition.
+	PSIInterval time.Duration
+	// PSIPacketInterval is the maximum number of TS packets between two
+	// PAT/PMT repetitions, zero disables packet based repetition.
+	PSIPacketInterval int
+	// PCRInterval is the maximum stream time between two PCRs on PcrPid,
+	// DefaultPCRInterval is used when zero.
+	PCRInterval time.Duration
+	// PCROffset is how far PCR runs behind the timestamps of the PES being
+	// written, DefaultPCROffset is used when zero. PCR is held at zero
+	// while timestamps are below the offset.
+	PCROffset time.Duration
+	// MuxRate is the constant output bitrate in bits per second, gaps are
+	// filled with null packets and PCR follows the packet position. Zero
+	// selects variable rate output.
+	MuxRate int64
+	// MaxInterleaveDelta enables queueing frames per stream and writing
+	// them in DTS order. A frame is written once every stream has a frame
+	// queued or the queued frames span more than the delta. Zero writes
+	// frames in arrival order.
+	MaxInterleaveDelta time.Duration
+	// MaxWait is the wall clock time after which a stream without queued
+	// frames is considered stalled and no longer waited for, zero waits
+	// until MaxInterleaveDelta is exceeded.
+	MaxWait time.Duration
+	// Splitter switches the destination at points it chooses, nil keeps a
+	// single destination.
+	Splitter Splitter
+	// AC3Signalling selects how AC-3 and E-AC-3 streams are announced in
+	// PMT, AC3SignallingATSC when zero.
+	AC3Signalling int
+}
+
+// Splitter cuts the output into parts which are decodable on their own.
+type Splitter interface {
+	// Split is called before every head packet is written in output order.
+	// A returned writer replaces the destination, which is flushed and
+	// closed, and the new output starts with PAT, PMT and PCR.
+	Split(sp *StreamPacket) (io.WriteCloser, error)
 }
 
+// cue is a splice_info_section waiting for the stream time it is sent at.
+type cue struct {
+	pid     uint16
+	pts     int64
+	payload []byte
+}
+
+type ProgramMeta struct {
+	ProgramNumber uint16
+	PmtPid        uint16
+	PcrPid        uint16
+	Descriptors   []*ts.Descriptor
+}
+
+// ServiceMeta describes the program with the same number in SDT.
+type ServiceMeta struct {
+	// ProgramNumber is the service_id, zero stands for the single program
+	// described by Config.PmtPid.
+	ProgramNumber uint16
+	// ServiceType is one of the ts.ServiceType values.
+	ServiceType  uint8
+	ProviderName string
+	ServiceName  string
+	// Descriptors follow the service descriptor.
+	Descriptors []*ts.Descriptor
+}
+
+const DefaultTransportStreamId = 1
+
+// DefaultOriginalNetworkId is the first network id of the private range.
+const DefaultOriginalNetworkId = 0xff01
+const DefaultPCRInterval = 40 * time.Millisecond
+const DefaultPCROffset = 500 * time.Millisecond
+
 type StreamPacket struct {
-	Data   []byte
-	Pid    uint16
-	Pts    int64
+	Data []byte
+	Pid  uint16
+	Pts  int64
+	// Dts is written only when it differs from Pts, use NoPts when the
+	// stream has no separate decoding timestamp.
+	Dts    int64
 	IsHead bool
+	// IsKey marks a head packet starting a random access point.
+	IsKey bool
+	// IsPriority sets elementary_stream_priority_indicator on the head
+	// packet.
+	IsPriority bool
+}
+
+func (sm *ServiceMeta) descriptor() *ts.Descriptor {
+	return ts.NewServiceDescriptor(sm.ServiceType, sm.ProviderName, sm.ServiceName)
+}
+
+func (sp *StreamPacket) hasDts() bool {
+	return sp.Pts != NoPts && sp.Dts != NoPts && sp.Dts != sp.Pts
+}
+
+// DecodingTs returns the timestamp the packet is decoded at.
+func (sp *StreamPacket) DecodingTs() int64 {
+	if sp.hasDts() {
+		return sp.Dts
+	}
+
+	return sp.Pts
 }
 
 type StreamMeta struct {
 	Pid          uint16
 	StreamId     uint8
 	StreamTypeId uint8
+	// ProgramNumber selects the program of Config.Programs, zero stands
+	// for the single program described by Config.PmtPid.
+	ProgramNumber uint16
+	Descriptors   []*ts.Descriptor
+	// AccessUnitAligned declares that every head packet starts with an
+	// access unit, it sets data_alignment_indicator of the PES header.
+	AccessUnitAligned bool
+	// FormatIdentifier is the registered format of metadata and private
+	// data streams, ts.FormatIdentifierID3 is used for metadata streams
+	// when zero. Private data streams announce it in a registration
+	// descriptor. Frames of ts.FormatIdentifierOpus streams are single Opus
+	// packets, which are given an opus_control_header. Frames of
+	// ts.FormatIdentifierAV01 streams are whole temporal units, their
+	// StreamId has to be zero or private_stream_1.
+	FormatIdentifier uint32
+	// PESDuration packs the ADTS frames of AAC streams, SAMPLE-AES encrypted
+	// or not, into PES lasting up to the duration, frames get timestamps
+	// derived from the sample count.
+	// Zero writes frames as they are given.
+	PESDuration time.Duration
 }
 
-func Run(
-	ctx context.Context,
-	destination io.WriteCloser,
-	pmtPid uint16,
-	pcrPid uint16,
-	streams []*StreamMeta,
-	inputStream <-chan *StreamPacket,
-) (<-chan struct{}, error) {
-	m := Muxer{}
+// setDefaults completes the configuration of metadata and private data
+// streams. Metadata streams carry one access unit per PES, in the metadata
+// stream_id for synchronous KLV and in private_stream_1 otherwise. AC-3
+// and E-AC-3 default to private_stream_1 as well.
+func (sm *StreamMeta) setDefaults() {
+	switch sm.StreamTypeId {
+	case ts.StreamTypeMetadata:
+		if sm.FormatIdentifier == 0 {
+			sm.FormatIdentifier = ts.FormatIdentifierID3
+		}
+		if sm.StreamId == 0 && sm.FormatIdentifier == ts.FormatIdentifierKLVA {
+			sm.StreamId = ts.StreamIdMetadata
+		}
+		if sm.StreamId == 0 {
+			sm.StreamId = ts.StreamIdPrivateStream1
+		}
+		sm.AccessUnitAligned = true
+	case ts.StreamTypePrivateData:
+		if sm.StreamId == 0 {
+			sm.StreamId = ts.StreamIdPrivateStream1
+		}
+		switch sm.FormatIdentifier {
+		case ts.FormatIdentifierKLVA, ts.FormatIdentifierOpus, ts.FormatIdentifierAV01:
+			sm.AccessUnitAligned = true
+		}
+	case ts.StreamTypeAudioAc3, ts.StreamTypeAudioEac3:
+		if sm.StreamId == 0 {
+			sm.StreamId = ts.StreamIdPrivateStream1
+		}
+	}
+}
+
+// isSection reports whether the stream carries sections instead of PES,
+// which is the case for SCTE-35 cues. StreamId is unused for these.
+func (sm *StreamMeta) isSection() bool {
+	return sm.StreamTypeId == ts.StreamTypeSCTE35
+}
+
+// New validates the configuration and writes the initial PAT and PMT.
+func New(destination io.WriteCloser, cfg Config) (*Muxer, error) {
+	m := &Muxer{}
 	m.destination = destination
-	m.pmtPid = pmtPid
-	m.pcrPid = pcrPid
+	m.output = bufio.NewWriterSize(destination, ts.PacketSize*64)
+	m.nitPid = cfg.NitPid
+	m.transportStreamId = cfg.TransportStreamId
+	if m.transportStreamId == 0 {
+		m.transportStreamId = DefaultTransportStreamId
+	}
 	m.streams = make(map[uint16]*StreamMeta)
+	m.streamPrograms = make(map[uint16]*program)
 	m.pidCounter = make(map[uint16]uint8)
+	m.psiInterval = toTsClock(cfg.PSIInterval)
+	m.psiPacketInterval = cfg.PSIPacketInterval
 
-	if m.pmtPid == 0 {
-		return nil, errors.New("invalid pmt pid")
+	if cfg.PCRInterval == 0 {
+		cfg.PCRInterval = DefaultPCRInterval
+	}
+	if cfg.PCROffset == 0 {
+		cfg.PCROffset = DefaultPCROffset
+	}
+	m.pcrInterval = toPCRClock(cfg.PCRInterval)
+	m.pcrOffset = toPCRClock(cfg.PCROffset)
+
+	programs := cfg.Programs
+	if len(programs) == 0 {
+		number := cfg.ProgramNumber
+		if number == 0 {
+			number = 1
+		}
+		programs = []*ProgramMeta{{ProgramNumber: number, PmtPid: cfg.PmtPid, PcrPid: cfg.PcrPid, Descriptors: cfg.ProgramDescriptors}}
 	}
 
-	if len(streams) == 0 {
+	if len(cfg.Streams) == 0 {
 		return nil, errors.New("no streams")
 	}
 
-	isValidPcrPID := false
-	for _, sm := range streams {
+	if cfg.VersionNumber > 0x1f {
+		return nil, errors.New("invalid version number")
+	}
+	m.patVersion = cfg.VersionNumber
+	m.sdtVersion = cfg.VersionNumber
+
+	m.originalNetworkId = cfg.OriginalNetworkId
+	if m.originalNetworkId == 0 {
+		m.originalNetworkId = DefaultOriginalNetworkId
+	}
+
+	if cfg.PSIInterval < 0 || m.psiPacketInterval < 0 {
+		return nil, errors.New("invalid psi interval")
+	}
+
+	if m.pcrInterval < 0 || m.pcrInterval > toPCRClock(100*time.Millisecond) || m.pcrOffset < 0 {
+		return nil, errors.New("invalid pcr timing")
+	}
+
+	if cfg.MuxRate < 0 {
+		return nil, errors.New("invalid mux rate")
+	}
+	m.muxRate = cfg.MuxRate
+
+	if cfg.MaxInterleaveDelta < 0 || cfg.MaxWait < 0 {
+		return nil, errors.New("invalid interleaving")
+	}
+	m.interleaveDelta = toTsClock(cfg.MaxInterleaveDelta)
+	m.maxWait = cfg.MaxWait
+	m.splitter = cfg.Splitter
+
+	if cfg.AC3Signalling != AC3SignallingATSC && cfg.AC3Signalling != AC3SignallingDVB {
+		return nil, errors.New("invalid ac3 signalling")
+	}
+	m.ac3Signalling = cfg.AC3Signalling
+
+	// PAT has to fit into a single packet
+	if len(programs) > 40 {
+		return nil, errors.New("too many programs")
+	}
+
+	for _, pm := range programs {
+		if pm.ProgramNumber == 0 {
+			return nil, errors.New("invalid program number")
+		}
+
+		if pm.PmtPid == 0 || pm.PmtPid == m.nitPid {
+			return nil, errors.New("invalid pmt pid")
+		}
+
+		for _, p := range m.programs {
+			if p.number == pm.ProgramNumber {
+				return nil, errors.New("duplicate program")
+			}
+		}
+
+		if err := validateDescriptors(pm.Descriptors); err != nil {
+			return nil, err
+		}
+
+		m.programs = append(m.programs, &program{
+			number:      pm.ProgramNumber,
+			pmtPid:      pm.PmtPid,
+			pcrPid:      pm.PcrPid,
+			descriptors: pm.Descriptors,
+			version:     cfg.VersionNumber,
+		})
+	}
+
+	for _, sm := range cfg.Services {
+		service := *sm
+		if len(cfg.Programs) == 0 && service.ProgramNumber == 0 {
+			service.ProgramNumber = m.programs[0].number
+		}
+
+		if m.findProgram(service.ProgramNumber) == nil {
+			return nil, errors.New("invalid program number")
+		}
+
+		for _, other := range m.services {
+			if other.ProgramNumber == service.ProgramNumber {
+				return nil, errors.New("duplicate service")
+			}
+		}
+
+		if err := service.descriptor().Validate(); err != nil {
+			return nil, err
+		}
+
+		if err := validateDescriptors(service.Descriptors); err != nil {
+			return nil, err
+		}
+
+		m.services = append(m.services, &service)
+	}
+
+	if m.services != nil {
+		if m.nitPid == ts.SDTPid || m.findPmtPid(ts.SDTPid) {
+			return nil, errors.New("invalid pid")
+		}
+
+		// SDT has to fit into a single packet
+		if len(m.createSDTPayload().Encode()) > ts.PacketSize-4 {
+			return nil, errors.New("sdt too large")
+		}
+	}
+
+	for _, sm := range cfg.Streams {
 		if _, exists := m.streams[sm.Pid]; exists {
 			return nil, errors.New("duplicate stream")
 		}
 		stream := *sm
+		stream.setDefaults()
 
-		if !ts.IsValidStreamId(stream.StreamId) {
-			return nil, errors.New("invalid stream id")
+		if err := m.validateStream(&stream); err != nil {
+			return nil, err
 		}
 
-		if !ts.IsValidStreamTypeId(stream.StreamTypeId) {
-			return nil, errors.New("invalid stream type id")
-		}
-
-		if m.pcrPid == stream.Pid {
-			isValidPcrPID = true
+		p := m.programs[0]
+		if len(cfg.Programs) > 0 {
+			p = m.findProgram(stream.ProgramNumber)
+			if p == nil {
+				return nil, errors.New("invalid program number")
+			}
 		}
 
+		p.streams = append(p.streams, &stream)
 		m.streams[sm.Pid] = &stream
+		m.streamPrograms[sm.Pid] = p
 	}
 
-	if !isValidPcrPID {
-		return nil, errors.New("invalid pcr pid")
+	if m.interleaveDelta > 0 {
+		m.queues = make(map[uint16]*streamQueue)
+		for pid, stream := range m.streams {
+			if !stream.isSection() {
+				m.queues[pid] = &streamQueue{lastSeen: time.Now()}
+			}
+		}
 	}
 
-	patBuf := bytes.NewBuffer(m.createPAT())
-	_, err := io.Copy(m.destination, patBuf)
-	if err != nil {
-		return nil, err
+	for _, p := range m.programs {
+		if m.streamPrograms[p.pcrPid] != p || m.streams[p.pcrPid].isSection() {
+			return nil, errors.New("invalid pcr pid")
+		}
+
+		if !m.fitsPMT(p) {
+			return nil, errors.New("pmt too large")
+		}
 	}
 
-	pmtBuf := bytes.NewBuffer(m.createPMT())
-	_, err = io.Copy(m.destination, pmtBuf)
+	err := m.writePSI()
 	if err != nil {
 		return nil, err
 	}
 
-	m.closeCh = make(chan struct{})
+	return m, nil
+}
+
+// WriteFrame packetizes a stream packet, write errors are sticky and
+// returned by every following call. With interleaving the packet is queued
+// and its data must not be modified afterwards.
+func (m *Muxer) WriteFrame(sp *StreamPacket) error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	if m.err != nil {
+		return m.err
+	}
+
+	stream, exists := m.streams[sp.Pid]
+	if !exists {
+		return ErrUnknownStream
+	}
+
+	if stream.isSection() {
+		return ErrSectionStream
+	}
+
+	if stream.isSyncKLV() {
+		var err error
+		if sp, err = m.wrapAUCell(sp, stream); err != nil {
+			return err
+		}
+	}
 
-	go m.process(ctx, inputStream)
+	if stream.isOpus() {
+		sp = wrapOpus(sp)
+	}
 
-	return m.closeCh, nil
+	if stream.isAV1() && sp.IsHead {
+		var err error
+		if sp, err = wrapAV1(sp); err != nil {
+			return err
+		}
+	}
+
+	if stream.isADTS() && stream.PESDuration > 0 {
+		for _, packed := range m.packAAC(sp, stream) {
+			if err := m.writeFrame(packed); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return m.writeFrame(sp)
 }
 
-func (m *Muxer) process(ctx context.Context, streamChannel <-chan *StreamPacket) {
-	go func() {
-		m.closeCh <- struct{}{}
-		close(m.closeCh)
-	}()
+func (m *Muxer) writeFrame(sp *StreamPacket) error {
+	if m.queues != nil {
+		m.enqueue(sp)
+		m.err = m.interleave(false)
+	} else {
+		m.err = m.writeStreamPacket(sp)
+	}
+
+	return m.err
+}
 
+// Flush writes packed and queued frames and buffered packets to the
+// destination.
+func (m *Muxer) Flush() error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	if m.err == nil {
+		m.err = m.flushAAC()
+	}
+
+	if m.err == nil {
+		m.err = m.interleave(true)
+	}
+
+	if m.err == nil {
+		m.err = m.output.Flush()
+	}
+
+	return m.err
+}
+
+// poll writes queued frames which no longer wait for stalled streams.
+func (m *Muxer) poll() error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	if m.err == nil {
+		m.err = m.interleave(false)
+	}
+
+	return m.err
+}
+
+// Close flushes buffered packets and closes the destination.
+func (m *Muxer) Close() error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	err := m.Flush()
+	m.closed = true
+
+	if closeErr := m.destination.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Abort drops the frames waiting for interleaving and closes the
+// destination. Packets which are muxed already are written, so the output
+// ends on a packet boundary.
+func (m *Muxer) Abort() error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	for _, q := range m.queues {
+		q.frames = nil
+	}
+	m.aacPackers = nil
+	m.closed = true
+
+	err := m.err
+	if err == nil {
+		err = m.output.Flush()
+	}
+
+	if closeErr := m.destination.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Overflows returns how many PES were sent after their decoding time because
+// the elementary streams exceed the constant mux rate.
+func (m *Muxer) Overflows() uint64 {
+	return m.overflows.Load()
+}
+
+// UpdateProgram replaces the PCR PID, descriptors and streams of an existing
+// program, queued frames are written first. When the tables change, their
+// version_number is incremented and PAT and PMT are sent right away.
+func (m *Muxer) UpdateProgram(pm *ProgramMeta, streams []*StreamMeta) error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	if m.err != nil {
+		return m.err
+	}
+
+	p := m.findProgram(pm.ProgramNumber)
+	if p == nil {
+		return errors.New("invalid program number")
+	}
+
+	if len(streams) == 0 {
+		return errors.New("no streams")
+	}
+
+	if err := validateDescriptors(pm.Descriptors); err != nil {
+		return err
+	}
+
+	updated := &program{
+		number:      p.number,
+		pmtPid:      pm.PmtPid,
+		pcrPid:      pm.PcrPid,
+		descriptors: pm.Descriptors,
+		version:     p.version,
+	}
+
+	pids := make(map[uint16]bool)
+	for _, sm := range streams {
+		if owner, exists := m.streamPrograms[sm.Pid]; pids[sm.Pid] || exists && owner != p {
+			return errors.New("duplicate stream")
+		}
+		stream := *sm
+		stream.setDefaults()
+
+		if err := m.validateStream(&stream); err != nil {
+			return err
+		}
+
+		updated.streams = append(updated.streams, &stream)
+		pids[stream.Pid] = true
+	}
+
+	if pm.PmtPid == 0 || pm.PmtPid == m.nitPid || pm.PmtPid >= ts.NullPID || pids[pm.PmtPid] || m.services != nil && pm.PmtPid == ts.SDTPid {
+		return errors.New("invalid pmt pid")
+	}
+	for _, other := range m.programs {
+		if other != p && (other.pmtPid == pm.PmtPid || m.streamPrograms[pm.PmtPid] == other) {
+			return errors.New("invalid pmt pid")
+		}
+	}
+
+	if !pids[pm.PcrPid] || slices.ContainsFunc(updated.streams, func(sm *StreamMeta) bool {
+		return sm.Pid == pm.PcrPid && sm.isSection()
+	}) {
+		return errors.New("invalid pcr pid")
+	}
+
+	if !m.fitsPMT(updated) {
+		return errors.New("pmt too large")
+	}
+
+	if m.err = m.flushAAC(); m.err != nil {
+		return m.err
+	}
+
+	if m.queues != nil {
+		if m.err = m.interleave(true); m.err != nil {
+			return m.err
+		}
+	}
+
+	isPATChanged := updated.pmtPid != p.pmtPid
+	isPMTChanged := isPATChanged || !bytes.Equal(m.createPMTPayload(updated).Encode(), m.createPMTPayload(p).Encode())
+	if !isPMTChanged {
+		return nil
+	}
+
+	for _, stream := range p.streams {
+		delete(m.streams, stream.Pid)
+		delete(m.streamPrograms, stream.Pid)
+		delete(m.aacPackers, stream.Pid)
+		if !pids[stream.Pid] {
+			delete(m.queues, stream.Pid)
+		}
+	}
+	for _, stream := range updated.streams {
+		m.streams[stream.Pid] = stream
+		m.streamPrograms[stream.Pid] = p
+		if _, exists := m.queues[stream.Pid]; !exists && m.queues != nil && !stream.isSection() {
+			m.queues[stream.Pid] = &streamQueue{lastSeen: time.Now()}
+		}
+	}
+
+	if updated.pcrPid != p.pcrPid {
+		p.hasPCR = false
+	}
+
+	p.pmtPid = updated.pmtPid
+	p.pcrPid = updated.pcrPid
+	p.descriptors = updated.descriptors
+	p.streams = updated.streams
+	p.version = (p.version + 1) & 0x1f
+	if isPATChanged {
+		m.patVersion = (m.patVersion + 1) & 0x1f
+	}
+
+	m.err = m.writePSI()
+
+	return m.err
+}
+
+// ScheduleCue sends a SCTE-35 section on the section stream pid once a frame
+// decoded at or after pts is written, NoPts sends it before the next frame.
+// Cues which are not due yet when the muxer is closed are dropped.
+func (m *Muxer) ScheduleCue(pid uint16, pts int64, section *ts.SpliceInfoSection) error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	if m.err != nil {
+		return m.err
+	}
+
+	stream, exists := m.streams[pid]
+	if !exists || !stream.isSection() {
+		return ErrUnknownStream
+	}
+
+	payload := &ts.Payload{}
+	payload.Type = ts.PayloadPSI
+	payload.PSI = &ts.PSI{}
+	payload.PSI.PointerField = 0
+	payload.PSI.SpliceInfo = section
+
+	c := &cue{pid: pid, pts: pts, payload: payload.Encode()}
+
+	// section_length is limited to 4093 bytes
+	if len(c.payload) > 1+4096 {
+		return errors.New("section too large")
+	}
+
+	i := slices.IndexFunc(m.cues, func(other *cue) bool {
+		return other.pts > pts
+	})
+	if i < 0 {
+		i = len(m.cues)
+	}
+	m.cues = slices.Insert(m.cues, i, c)
+
+	return nil
+}
+
+func (m *Muxer) validateStream(stream *StreamMeta) error {
+	if !m.isStreamPid(stream.Pid) {
+		return errors.New("invalid pid")
+	}
+
+	if !ts.IsValidStreamId(stream.StreamId) && !stream.isSection() {
+		return errors.New("invalid stream id")
+	}
+
+	if stream.PESDuration < 0 {
+		return errors.New("invalid pes duration")
+	}
+
+	// AV1 is only carried in private_stream_1
+	if stream.isAV1() && stream.StreamId != ts.StreamIdPrivateStream1 {
+		return errors.New("invalid stream id")
+	}
+
+	if !ts.IsValidStreamTypeId(stream.StreamTypeId) {
+		return errors.New("invalid stream type id")
+	}
+
+	return validateDescriptors(stream.Descriptors)
+}
+
+// fitsPMT reports whether the PMT of p fits into a single packet.
+func (m *Muxer) fitsPMT(p *program) bool {
+	return len(m.createPMTPayload(p).Encode()) <= ts.PacketSize-4
+}
+
+func validateDescriptors(descriptors []*ts.Descriptor) error {
+	for _, d := range descriptors {
+		if err := d.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Muxer) isStreamPid(pid uint16) bool {
+	if pid == 0 || pid == m.nitPid || pid >= ts.NullPID {
+		return false
+	}
+
+	if m.services != nil && pid == ts.SDTPid {
+		return false
+	}
+
+	return !m.findPmtPid(pid)
+}
+
+func (m *Muxer) findPmtPid(pid uint16) bool {
+	for _, p := range m.programs {
+		if pid == p.pmtPid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// programDescriptors returns the program_info descriptors, the CUEI
+// registration is added for programs carrying SCTE-35 and metadata pointers
+// for metadata streams unless they are configured.
+func (p *program) programDescriptors() []*ts.Descriptor {
+	descriptors := slices.Clone(p.descriptors)
+
+	if slices.ContainsFunc(p.streams, (*StreamMeta).isSection) && !slices.ContainsFunc(p.descriptors, func(d *ts.Descriptor) bool {
+		return d.RegistrationDescriptor != nil && d.RegistrationDescriptor.FormatIdentifier == ts.FormatIdentifierCUEI
+	}) {
+		descriptors = append([]*ts.Descriptor{ts.NewRegistrationDescriptor(ts.FormatIdentifierCUEI, nil)}, descriptors...)
+	}
+
+	if !slices.ContainsFunc(p.descriptors, hasTag(ts.DescriptorTagMetadataPointer)) {
+		for i, stream := range p.metadataStreams() {
+			descriptors = append(descriptors, ts.NewMetadataPointerDescriptor(&ts.MetadataPointerDescriptor{
+				MetadataApplicationFormat:           ts.MetadataApplicationFormatIdentifier,
+				MetadataApplicationFormatIdentifier: stream.FormatIdentifier,
+				MetadataFormat:                      ts.MetadataFormatIdentifier,
+				MetadataFormatIdentifier:            stream.FormatIdentifier,
+				MetadataServiceId:                   uint8(i),
+				ProgramNumber:                       p.number,
+			}))
+		}
+	}
+
+	return descriptors
+}
+
+// streamDescriptors returns the ES_info descriptors of stream, metadata
+// streams get a metadata descriptor and private data streams with a format
+// identifier a registration descriptor unless it is configured.
+func (p *program) streamDescriptors(stream *StreamMeta) []*ts.Descriptor {
+	if stream.StreamTypeId == ts.StreamTypePrivateData && stream.FormatIdentifier != 0 &&
+		!slices.ContainsFunc(stream.Descriptors, hasTag(ts.DescriptorTagRegistration)) {
+		return append([]*ts.Descriptor{ts.NewRegistrationDescriptor(stream.FormatIdentifier, nil)}, stream.Descriptors...)
+	}
+
+	i := slices.Index(p.metadataStreams(), stream)
+	if i < 0 || slices.ContainsFunc(stream.Descriptors, hasTag(ts.DescriptorTagMetadata)) {
+		return stream.Descriptors
+	}
+
+	return append(slices.Clone(stream.Descriptors), ts.NewMetadataDescriptor(&ts.MetadataDescriptor{
+		MetadataApplicationFormat:           ts.MetadataApplicationFormatIdentifier,
+		MetadataApplicationFormatIdentifier: stream.FormatIdentifier,
+		MetadataFormat:                      ts.MetadataFormatIdentifier,
+		MetadataFormatIdentifier:            stream.FormatIdentifier,
+		MetadataServiceId:                   uint8(i),
+	}))
+}
+
+func (p *program) metadataStreams() []*StreamMeta {
+	streams := make([]*StreamMeta, 0)
+	for _, stream := range p.streams {
+		if stream.StreamTypeId == ts.StreamTypeMetadata {
+			streams = append(streams, stream)
+		}
+	}
+
+	return streams
+}
+
+func hasTag(tag uint8) func(d *ts.Descriptor) bool {
+	return func(d *ts.Descriptor) bool {
+		return d.DescriptorTag == tag
+	}
+}
+
+func (m *Muxer) findProgram(number uint16) *program {
+	for _, p := range m.programs {
+		if p.number == number {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func (m *Muxer) writeStreamPacket(sp *StreamPacket) error {
 	var l int
 	var err error
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case sp, isActive := <-streamChannel:
-			if !isActive {
-				return
+
+	p := m.streamPrograms[sp.Pid]
+
+	if sp.IsHead && m.splitter != nil {
+		w, err := m.splitter.Split(sp)
+		if err != nil {
+			return err
+		}
+
+		if w != nil {
+			err = m.switchDestination(w)
+			if err != nil {
+				return err
 			}
+		}
+	}
+
+	reader := bytes.NewBuffer(sp.Data)
+	buffer := make([]byte, 184)
 
-			reader := bytes.NewBuffer(sp.Data)
-			buffer := make([]byte, 184)
+	if sp.IsHead && sp.Pts != NoPts {
+		m.advanceClock(sp.DecodingTs())
+		p.pcrClock = sp.DecodingTs()
 
-			if _, existsPid := m.pidCounter[sp.Pid]; !existsPid {
-				m.pidCounter[sp.Pid] = 0
+		if m.muxRate > 0 {
+			err = m.stuffUntil(sp.DecodingTs())
+			if err != nil {
+				return err
 			}
+		}
+	}
+
+	if sp.IsHead {
+		err = m.writeCues()
+		if err != nil {
+			return err
+		}
+	}
+
+	if sp.IsHead {
+		carrier := (*program)(nil)
+		if sp.Pid == p.pcrPid {
+			carrier = p
+		}
+
+		err = m.beforePacket(carrier)
+		if err != nil {
+			return err
+		}
+
+		pcr, hasPCR := uint64(0), false
+		if carrier != nil && m.isPCRRequired(p) {
+			pcr, hasPCR = m.nextPCR(p), true
+		}
+
+		adaptPack := m.createAdaptationPacket(sp, pcr, hasPCR, reader.Len(), m.pidCounter[sp.Pid], m.streams[sp.Pid])
+
+		l, _ = reader.Read(adaptPack.Payload.PES.Data)
+		if l == 0 {
+			return nil
+		}
+
+		err = m.writePacket(adaptPack.Encode())
+		if err != nil {
+			return err
+		}
+		m.nextCounter(sp.Pid)
+	}
+
+	for {
+		l, _ = reader.Read(buffer)
+		if l == 0 {
+			return nil
+		}
+
+		err = m.beforePacket(nil)
+		if err != nil {
+			return err
+		}
+
+		err = m.writePacket(m.createDataPacket(sp.Pid, buffer, l, m.pidCounter[sp.Pid]))
+		if err != nil {
+			return err
+		}
+
+		m.nextCounter(sp.Pid)
+	}
+}
 
-			if sp.IsHead {
-				adaptPack := m.createAdaptationPacket(sp.Pid, uint64(sp.Pts), sp.Pts != NoPts, sp.IsHead, reader.Len(), m.pidCounter[sp.Pid], m.streams[sp.Pid].StreamId)
+// writeCues writes the scheduled cues which are due at the current stream
+// time, cues of removed streams are dropped.
+func (m *Muxer) writeCues() error {
+	for len(m.cues) > 0 && m.cues[0].pts <= m.clock {
+		c := m.cues[0]
+		m.cues[0] = nil
+		m.cues = m.cues[1:]
 
-				l, err = reader.Read(adaptPack.Payload.PES.Data)
-				if l == 0 || err != nil {
-					continue
-				}
+		if _, exists := m.streams[c.pid]; !exists {
+			continue
+		}
 
-				_, err = m.destination.Write(adaptPack.Encode())
-				if err != nil {
-					continue
-				}
+		for offset := 0; offset < len(c.payload); offset += ts.PacketSize - 4 {
+			if err := m.beforePacket(nil); err != nil {
+				return err
 			}
 
-			m.pidCounter[sp.Pid]++
-			if m.pidCounter[sp.Pid] == 16 {
-				m.pidCounter[sp.Pid] = 0
+			packet := m.createSectionPacket(c.pid, c.payload[offset:], offset == 0, m.nextCounter(c.pid))
+			if err := m.writePacket(packet); err != nil {
+				return err
 			}
+		}
+	}
+
+	return nil
+}
+
+// switchDestination closes the current destination and continues on w with
+// fresh tables and PCR, continuity counters carry on.
+func (m *Muxer) switchDestination(w io.WriteCloser) error {
+	err := m.output.Flush()
+	if closeErr := m.destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	m.destination = w
+	m.output.Reset(w)
 
-			for {
-				l, err = reader.Read(buffer)
-				if l > 0 {
-					_, err = m.destination.Write(m.createDataPacket(sp.Pid, buffer, l, m.pidCounter[sp.Pid]))
-				}
+	for _, p := range m.programs {
+		p.hasPCR = false
+	}
 
-				if err != nil {
-					break
-				}
+	return m.writePSI()
+}
 
-				m.pidCounter[sp.Pid]++
-				if m.pidCounter[sp.Pid] == 16 {
-					m.pidCounter[sp.Pid] = 0
-				}
+func (m *Muxer) advanceClock(pts int64) {
+	if m.clock == 0 {
+		m.psiClock = pts
+	}
+	if pts > m.clock {
+		m.clock = pts
+	}
+}
+
+// beforePacket writes tables and PCR which are due before the next payload
+// packet, carrier is the program whose PCR the next packet carries itself.
+func (m *Muxer) beforePacket(carrier *program) error {
+	if m.isPSIRequired() {
+		if err := m.writePSI(); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range m.programs {
+		if p != carrier && m.isPCRRequired(p) {
+			if err := m.writePacket(m.createPCRPacket(p, m.nextPCR(p))); err != nil {
+				return err
 			}
 		}
 	}
+
+	return nil
+}
+
+// stuffUntil fills the constant rate output with null packets until the
+// system clock reaches the send time of a PES decoded at dts. A PES which
+// can't be sent before dts counts as overflow.
+func (m *Muxer) stuffUntil(dts int64) error {
+	target := dts*300 - m.pcrOffset
+
+	if !m.hasPCRBase {
+		m.pcrBase = max(target, 0) - m.packetTime(m.packetCount)
+		m.hasPCRBase = true
+	}
+
+	for m.outputClock() < target {
+		if err := m.beforePacket(nil); err != nil {
+			return err
+		}
+
+		if m.outputClock() >= target {
+			break
+		}
+
+		if err := m.writePacket(m.createNullPacket()); err != nil {
+			return err
+		}
+	}
+
+	if target >= 0 && m.outputClock() > dts*300 {
+		m.overflows.Add(1)
+	}
+
+	return nil
+}
+
+// packetTime returns the 27 MHz time needed to send count packets at the
+// constant mux rate, PCR is sampled at the last byte of its base.
+func (m *Muxer) packetTime(count int64) int64 {
+	bits := (count*ts.PacketSize + 10) * 8
+
+	return bits/m.muxRate*27_000_000 + bits%m.muxRate*27_000_000/m.muxRate
+}
+
+func (m *Muxer) writePacket(b []byte) error {
+	_, err := m.output.Write(b)
+	if err != nil {
+		return err
+	}
+	m.packetsSincePSI++
+	m.packetCount++
+
+	return nil
+}
+
+func (m *Muxer) isPSIRequired() bool {
+	if m.psiPacketInterval > 0 && m.packetsSincePSI >= m.psiPacketInterval {
+		return true
+	}
+
+	return m.psiInterval > 0 && m.clock-m.psiClock >= m.psiInterval
+}
+
+func (m *Muxer) writePSI() error {
+	err := m.writePacket(m.createPAT(m.nextCounter(0)))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range m.programs {
+		err = m.writePacket(m.createPMT(p, m.nextCounter(p.pmtPid)))
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.services != nil {
+		err = m.writePacket(m.createSDT(m.nextCounter(ts.SDTPid)))
+		if err != nil {
+			return err
+		}
+	}
+
+	m.packetsSincePSI = 0
+	m.psiClock = m.clock
+
+	return nil
+}
+
+func toPCRClock(d time.Duration) int64 {
+	return d.Nanoseconds() * 27 / 1000
+}
+
+// toTsClock converts d to the 90 kHz clock of PTS and DTS, rounding up so
+// that short durations do not become zero.
+func toTsClock(d time.Duration) int64 {
+	return (d.Nanoseconds()*9 + 99999) / 100000
+}
+
+// outputClock returns the 27 MHz time of the next packet at constant rate.
+func (m *Muxer) outputClock() int64 {
+	return max(m.pcrBase+m.packetTime(m.packetCount), 0)
+}
+
+// currentPCR returns the 27 MHz system clock of program p at the next
+// packet. At constant rate it follows the packet position, otherwise it is
+// derived from the timestamp of the PES being written. It never runs
+// backwards.
+func (m *Muxer) currentPCR(p *program) int64 {
+	if m.muxRate > 0 {
+		return m.outputClock()
+	}
+
+	pcr := p.pcrClock*300 - m.pcrOffset
+	if pcr < p.lastPCR {
+		pcr = p.lastPCR
+	}
+	if pcr < 0 {
+		pcr = 0
+	}
+
+	return pcr
 }
 
-func (m *Muxer) createPAT() []byte {
+func (m *Muxer) isPCRRequired(p *program) bool {
+	if !p.hasPCR {
+		return true
+	}
+
+	if m.muxRate > 0 {
+		return m.currentPCR(p)-p.lastPCR >= m.pcrInterval
+	}
+
+	return m.currentPCR(p)-p.lastPCR >= m.pcrInterval || (p.pcrClock-p.lastPCRClock)*300 >= m.pcrInterval
+}
+
+func (m *Muxer) nextPCR(p *program) uint64 {
+	p.lastPCR = m.currentPCR(p)
+	p.lastPCRClock = p.pcrClock
+	p.hasPCR = true
+
+	return uint64(p.lastPCR)
+}
+
+// nextCounter returns the continuity counter for the next packet of pid.
+func (m *Muxer) nextCounter(pid uint16) uint8 {
+	counter := m.pidCounter[pid]
+	m.pidCounter[pid] = (counter + 1) & 0xf
+
+	return counter
+}
+
+func (m *Muxer) createPAT(counter uint8) []byte {
 	packet := ts.Packet{}
 
 	h := &ts.Header{}
@@ -171,7 +1240,7 @@ func (m *Muxer) createPAT() []byte {
 	h.PID = 0
 	h.TransportScramblingControl = 0
 	h.AdaptationFieldControl = 0x1
-	h.ContinuityCounter = 0
+	h.ContinuityCounter = counter
 
 	packet.Header = h
 
@@ -186,18 +1255,27 @@ func (m *Muxer) createPAT() []byte {
 	payload.PSI.PAT.Reserved2 = 0x3
 	payload.PSI.PAT.Reserved = 0x3
 
-	payload.PSI.PAT.SectionLength = 13
-	payload.PSI.PAT.TransportStreamId = 1
-	payload.PSI.PAT.VersionNumber = 0
+	payload.PSI.PAT.TransportStreamId = m.transportStreamId
+	payload.PSI.PAT.VersionNumber = m.patVersion
 	payload.PSI.PAT.CurrentNextIndicator = true
 	payload.PSI.PAT.SectionNumber = 0x0
 	payload.PSI.PAT.LastSectionNumber = 0x0
 
-	payload.PSI.PAT.TableData = make([]*ts.TableData, 1)
-	payload.PSI.PAT.TableData[0] = &ts.TableData{
-		ProgramNumber: 1,
-		Reserved:      0x7,
-		PID:           m.pmtPid,
+	payload.PSI.PAT.TableData = make([]*ts.TableData, 0, len(m.programs)+1)
+	if m.nitPid != 0 {
+		payload.PSI.PAT.TableData = append(payload.PSI.PAT.TableData, &ts.TableData{
+			ProgramNumber: 0,
+			Reserved:      0x7,
+			PID:           m.nitPid,
+			IsNetworkPID:  true,
+		})
+	}
+	for _, p := range m.programs {
+		payload.PSI.PAT.TableData = append(payload.PSI.PAT.TableData, &ts.TableData{
+			ProgramNumber: p.number,
+			Reserved:      0x7,
+			PID:           p.pmtPid,
+		})
 	}
 
 	packet.Payload = payload
@@ -205,7 +1283,7 @@ func (m *Muxer) createPAT() []byte {
 	return packet.Encode()
 }
 
-func (m *Muxer) createPMT() []byte {
+func (m *Muxer) createPMT(p *program, counter uint8) []byte {
 	packet := ts.Packet{}
 
 	h := &ts.Header{}
@@ -213,22 +1291,27 @@ func (m *Muxer) createPMT() []byte {
 	h.TransportErrorIndicator = false
 	h.PayloadUntilStartIndicator = true
 	h.TransportPriority = false
-	h.PID = m.pmtPid
+	h.PID = p.pmtPid
 	h.TransportScramblingControl = 0
 	h.AdaptationFieldControl = 0x1
-	h.ContinuityCounter = 0
+	h.ContinuityCounter = counter
 
 	packet.Header = h
+	packet.Payload = m.createPMTPayload(p)
+
+	return packet.Encode()
+}
 
+func (m *Muxer) createPMTPayload(p *program) *ts.Payload {
 	pmt := ts.NewPMT()
 	pmt.SectionSyntaxIndicator = true
-	pmt.ProgramNumber = 0x1
-	pmt.VersionNumber = 0x0
+	pmt.ProgramNumber = p.number
+	pmt.VersionNumber = p.version
 	pmt.CurrentNextIndicator = true
 	pmt.SectionNumber = 0
 	pmt.LastSectionNumber = 0
-	pmt.PCRPID = m.pcrPid
-	pmt.ProgramInfoLength = 0
+	pmt.PCRPID = p.pcrPid
+	pmt.ProgramInfo = &ts.ProgramInfo{Descriptors: p.programDescriptors()}
 	pmt.Reserved = 3
 	pmt.Reserved2 = 3
 	pmt.Reserved3 = 7
@@ -236,22 +1319,130 @@ func (m *Muxer) createPMT() []byte {
 
 	esInfo := &ts.ESInfo{}
 	esInfo.Streams = make([]*ts.Stream, 0)
-	for _, v := range m.streams {
+	for _, v := range p.streams {
+		streamType, descriptors := v.StreamTypeId, p.streamDescriptors(v)
+		if m.ac3Signalling == AC3SignallingDVB {
+			streamType, descriptors = dvbAC3Signalling(v, descriptors)
+		}
+
 		esInfo.Streams = append(esInfo.Streams, &ts.Stream{
-			StreamType:    v.StreamTypeId,
+			StreamType:    streamType,
 			Reserved:      7,
 			ElementaryPID: v.Pid,
 			Reserved2:     15,
+			Descriptors:   descriptors,
 		})
 	}
 
 	pmt.EsInfo = esInfo
 
+	payload := &ts.Payload{}
+	payload.Type = ts.PayloadPSI
+	payload.PSI = &ts.PSI{}
+	payload.PSI.PointerField = 0
+	payload.PSI.PMT = pmt
+
+	return payload
+}
+
+func (m *Muxer) createSDT(counter uint8) []byte {
+	packet := ts.Packet{}
+
+	h := &ts.Header{}
+	h.SyncByte = 0x47
+	h.TransportErrorIndicator = false
+	h.PayloadUntilStartIndicator = true
+	h.TransportPriority = false
+	h.PID = ts.SDTPid
+	h.TransportScramblingControl = 0
+	h.AdaptationFieldControl = 0x1
+	h.ContinuityCounter = counter
+
+	packet.Header = h
+	packet.Payload = m.createSDTPayload()
+
+	return packet.Encode()
+}
+
+func (m *Muxer) createSDTPayload() *ts.Payload {
+	sdt := ts.NewSDT()
+	sdt.SectionSyntaxIndicator = true
+	sdt.Reserved = 0x7
+	sdt.TransportStreamId = m.transportStreamId
+	sdt.Reserved2 = 0x3
+	sdt.VersionNumber = m.sdtVersion
+	sdt.CurrentNextIndicator = true
+	sdt.SectionNumber = 0
+	sdt.LastSectionNumber = 0
+	sdt.OriginalNetworkId = m.originalNetworkId
+	sdt.Reserved3 = 0xff
+
+	for _, service := range m.services {
+		sdt.Services = append(sdt.Services, &ts.SDTService{
+			ServiceId:     service.ProgramNumber,
+			Reserved:      0x3f,
+			RunningStatus: ts.RunningStatusRunning,
+			Descriptors:   append([]*ts.Descriptor{service.descriptor()}, service.Descriptors...),
+		})
+	}
+
+	payload := &ts.Payload{}
+	payload.Type = ts.PayloadPSI
+	payload.PSI = &ts.PSI{}
+	payload.PSI.PointerField = 0
+	payload.PSI.SDT = sdt
+
+	return payload
+}
+
+// createSectionPacket builds a packet from the next part of a section
+// payload, the remainder of the last packet is filled with 0xff.
+func (m *Muxer) createSectionPacket(pid uint16, data []byte, isStart bool, counter uint8) []byte {
+	packet := ts.Packet{}
+
+	h := ts.Header{}
+
+	h.SyncByte = 0x47
+	h.TransportErrorIndicator = false
+	h.PayloadUntilStartIndicator = isStart
+	h.TransportPriority = false
+	h.PID = pid
+	h.TransportScramblingControl = 0
+	h.AdaptationFieldControl = 0x1
+	h.ContinuityCounter = counter
+
+	packet.Header = &h
+	packet.Payload = &ts.Payload{}
+	packet.Payload.Type = ts.PayloadRawData
+
+	buf := make([]byte, ts.PacketSize-4)
+	n := copy(buf, data)
+	for i := n; i < len(buf); i++ {
+		buf[i] = 255
+	}
+	packet.Payload.RawData = ts.NewRawData(packet.Payload, buf)
+
+	return packet.Encode()
+}
+
+func (m *Muxer) createNullPacket() []byte {
+	packet := ts.Packet{}
+
+	h := ts.Header{}
+
+	h.SyncByte = 0x47
+	h.PID = ts.NullPID
+	h.AdaptationFieldControl = 0x1
+
+	packet.Header = &h
 	packet.Payload = &ts.Payload{}
-	packet.Payload.Type = ts.PayloadPSI
-	packet.Payload.PSI = &ts.PSI{}
-	packet.Payload.PSI.PointerField = 0
-	packet.Payload.PSI.PMT = pmt
+	packet.Payload.Type = ts.PayloadRawData
+
+	data := make([]byte, ts.PacketSize-4)
+	for i := 0; i < len(data); i++ {
+		data[i] = 255
+	}
+	packet.Payload.RawData = ts.NewRawData(packet.Payload, data)
 
 	return packet.Encode()
 }
@@ -296,7 +1487,37 @@ func (m *Muxer) createDataPacket(pid uint16, data []byte, dataLen int, counter u
 	return packet.Encode()
 }
 
-func (m *Muxer) createAdaptationPacket(pid uint16, pts uint64, hasPTS bool, needPCR bool, buffRemainLen int, counter uint8, streamId uint8) *ts.Packet {
+// createPCRPacket builds an adaptation only packet carrying PCR, it repeats
+// the last continuity counter of the PCR PID as there is no payload.
+func (m *Muxer) createPCRPacket(p *program, pcr uint64) []byte {
+	packet := ts.Packet{}
+
+	h := ts.Header{}
+
+	h.SyncByte = 0x47
+	h.TransportErrorIndicator = false
+	h.PayloadUntilStartIndicator = false
+	h.TransportPriority = false
+	h.PID = p.pcrPid
+	h.TransportScramblingControl = 0
+	h.AdaptationFieldControl = 0x2
+	h.ContinuityCounter = (m.pidCounter[p.pcrPid] - 1) & 0xf
+
+	packet.Header = &h
+
+	packet.Adaptation = &ts.AdaptationField{}
+	packet.Adaptation.AdaptationFieldLength = 1
+	packet.Adaptation.PcrFlag = true
+	packet.Adaptation.SetPCR(pcr)
+	packet.Adaptation.StuffingBytes = make([]byte, ts.PacketSize-4-8)
+	for i := 0; i < len(packet.Adaptation.StuffingBytes); i++ {
+		packet.Adaptation.StuffingBytes[i] = 255
+	}
+
+	return packet.Encode()
+}
+
+func (m *Muxer) createAdaptationPacket(sp *StreamPacket, pcr uint64, hasPCR bool, buffRemainLen int, counter uint8, stream *StreamMeta) *ts.Packet {
 	packet := ts.Packet{}
 
 	h := ts.Header{}
@@ -305,7 +1526,7 @@ func (m *Muxer) createAdaptationPacket(pid uint16, pts uint64, hasPTS bool, need
 	h.TransportErrorIndicator = false
 	h.PayloadUntilStartIndicator = true
 	h.TransportPriority = false
-	h.PID = pid
+	h.PID = sp.Pid
 	h.TransportScramblingControl = 0
 	h.AdaptationFieldControl = 0x3
 	h.ContinuityCounter = counter
@@ -313,42 +1534,39 @@ func (m *Muxer) createAdaptationPacket(pid uint16, pts uint64, hasPTS bool, need
 	packet.Header = &h
 
 	packet.Adaptation = &ts.AdaptationField{}
-	packet.Adaptation.RndAccessIndicator = false
+	packet.Adaptation.RndAccessIndicator = sp.IsKey
+	packet.Adaptation.EsPriorityIndicator = sp.IsPriority
 	packet.Adaptation.AdaptationFieldLength = 1
 
 	packet.Payload = ts.NewPayload(&packet)
 	packet.Payload.Type = ts.PayloadPES
 
 	pes := ts.NewPES(packet.Payload)
-	pes.StreamId = streamId
+	pes.StreamId = stream.StreamId
 	pes.Header = &ts.PESHeader{}
 	pes.Header.Marker = 2
+	pes.Header.DataAlignmentIndicator = stream.AccessUnitAligned
 
-	if !hasPTS {
+	if sp.Pts == NoPts {
 		pes.Header.PTSDTSIndicator = 0x0
 		pes.Header.PESHeaderDataLength = 0
 		pes.Header.Data = &ts.PESHeaderData{}
+	} else if sp.hasDts() {
+		pes.Header.PTSDTSIndicator = 0x3
+		pes.Header.PESHeaderDataLength = 10
+		pes.Header.Data = &ts.PESHeaderData{}
+		pes.Header.Data.PTS = uint64(sp.Pts)
+		pes.Header.Data.DTS = uint64(sp.Dts)
 	} else {
 		pes.Header.PTSDTSIndicator = 0x2
 		pes.Header.PESHeaderDataLength = 5
 		pes.Header.Data = &ts.PESHeaderData{}
-		pes.Header.Data.PTS = pts
+		pes.Header.Data.PTS = uint64(sp.Pts)
 	}
 
-	if needPCR && pid == m.pcrPid {
+	if hasPCR {
 		packet.Adaptation.PcrFlag = true
-
-		pcr := uint64(0)
-		if hasPTS && pts > 50 {
-			pcr = (pts - 50) << 9
-		}
-
-		packet.Adaptation.PCR[0] = uint8((pcr >> 34) & 0xff)
-		packet.Adaptation.PCR[1] = uint8((pcr >> 26) & 0xff)
-		packet.Adaptation.PCR[2] = uint8((pcr >> 18) & 0xff)
-		packet.Adaptation.PCR[3] = uint8((pcr >> 10) & 0xff)
-		packet.Adaptation.PCR[4] = uint8(0x7e | ((pcr & (1 << 9)) >> 2) | ((pcr & (1 << 8)) >> 8))
-		packet.Adaptation.PCR[5] = uint8(pcr & 0xff)
+		packet.Adaptation.SetPCR(pcr)
 	}
 
 	packet.Payload.PES = pes
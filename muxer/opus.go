@@ -0,0 +1,17 @@
+package muxer
+
+import "mpegts/ts"
+
+func (sm *StreamMeta) isOpus() bool {
+	return sm.StreamTypeId == ts.StreamTypePrivateData && sm.FormatIdentifier == ts.FormatIdentifierOpus
+}
+
+// wrapOpus returns a copy of sp whose Opus packet is framed as access unit.
+func wrapOpus(sp *StreamPacket) *StreamPacket {
+	au := &ts.OpusAccessUnit{Data: sp.Data}
+
+	wrapped := *sp
+	wrapped.Data = au.Encode()
+
+	return &wrapped
+}
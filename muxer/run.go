@@ -0,0 +1,182 @@
+package muxer
+
+import (
+	"context"
+	"io"
+	"mpegts/ts"
+	"sync"
+	"time"
+)
+
+// Handle tracks a muxer goroutine started by Run.
+type Handle struct {
+	muxer     *Muxer
+	done      chan struct{}
+	calls     chan *call
+	mu        sync.Mutex
+	err       error
+	rejected  uint64
+	rejectErr error
+}
+
+// call runs a muxer method in the muxer goroutine.
+type call struct {
+	apply  func(m *Muxer) error
+	result chan error
+}
+
+// Done is closed once the muxer goroutine has stopped and the destination
+// is closed.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns the first fatal error which stopped the muxer goroutine, it
+// is the context error when muxing was aborted.
+func (h *Handle) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.err
+}
+
+// Rejected returns how many packets of the input channel were dropped
+// because Muxer.WriteFrame refused them, together with the last reason.
+// Muxing goes on after a rejected packet.
+func (h *Handle) Rejected() (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.rejected, h.rejectErr
+}
+
+// Overflows returns how many PES were sent after their decoding time because
+// the elementary streams exceed the constant mux rate.
+func (h *Handle) Overflows() uint64 {
+	return h.muxer.Overflows()
+}
+
+// UpdateProgram applies Muxer.UpdateProgram in the muxer goroutine. Packets
+// already sent to the input channel are muxed with the configuration they
+// find when they are read.
+func (h *Handle) UpdateProgram(pm *ProgramMeta, streams []*StreamMeta) error {
+	return h.call(func(m *Muxer) error {
+		return m.UpdateProgram(pm, streams)
+	})
+}
+
+// ScheduleCue applies Muxer.ScheduleCue in the muxer goroutine.
+func (h *Handle) ScheduleCue(pid uint16, pts int64, section *ts.SpliceInfoSection) error {
+	return h.call(func(m *Muxer) error {
+		return m.ScheduleCue(pid, pts, section)
+	})
+}
+
+func (h *Handle) call(apply func(m *Muxer) error) error {
+	c := &call{apply: apply, result: make(chan error, 1)}
+
+	select {
+	case h.calls <- c:
+		return <-c.result
+	case <-h.done:
+		return ErrClosed
+	}
+}
+
+func (h *Handle) reject(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rejected++
+	h.rejectErr = err
+}
+
+func (h *Handle) setErr(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err == nil {
+		h.err = err
+	}
+}
+
+// Run starts a goroutine muxing packets of inputStream, closing the channel
+// drains it and closes the destination while cancelling ctx aborts.
+func Run(
+	ctx context.Context,
+	destination io.WriteCloser,
+	cfg Config,
+	inputStream <-chan *StreamPacket,
+) (*Handle, error) {
+	m, err := New(destination, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Handle{muxer: m, done: make(chan struct{}), calls: make(chan *call)}
+
+	go h.process(ctx, inputStream)
+
+	return h, nil
+}
+
+// process muxes packets until the input channel is closed and drained or
+// the context is cancelled. Queued frames are written in the former case
+// and dropped by Muxer.Abort in the latter, the destination is closed in
+// both cases.
+func (h *Handle) process(ctx context.Context, streamChannel <-chan *StreamPacket) {
+	defer close(h.done)
+
+	err := h.consume(ctx, streamChannel)
+
+	closeMuxer := h.muxer.Close
+	if ctx.Err() != nil {
+		closeMuxer = h.muxer.Abort
+	}
+
+	if closeErr := closeMuxer(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		h.setErr(err)
+	}
+}
+
+func (h *Handle) consume(ctx context.Context, streamChannel <-chan *StreamPacket) error {
+	var tick <-chan time.Time
+	if h.muxer.queues != nil && h.muxer.maxWait > 0 {
+		ticker := time.NewTicker(h.muxer.maxWait)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+			if err := h.muxer.poll(); err != nil {
+				return err
+			}
+		case c := <-h.calls:
+			c.result <- c.apply(h.muxer)
+			// invalid arguments are rejected, write errors stop muxing
+			if h.muxer.err != nil {
+				return h.muxer.err
+			}
+		case sp, isActive := <-streamChannel:
+			if !isActive {
+				return nil
+			}
+
+			// invalid frames are dropped, write errors stop muxing
+			if err := h.muxer.WriteFrame(sp); err != nil {
+				if h.muxer.err != nil {
+					return h.muxer.err
+				}
+				h.reject(err)
+			}
+		}
+	}
+}
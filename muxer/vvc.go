@@ -0,0 +1,94 @@
+package muxer
+
+const (
+	vvcNalIDRWRADL   = 7
+	vvcNalCRA        = 9
+	vvcNalOPI        = 12
+	vvcNalVPS        = 14
+	vvcNalSPS        = 15
+	vvcNalPPS        = 16
+	vvcNalPrefixAPS  = 17
+	vvcNalPH         = 19
+	vvcNalAUD        = 20
+	vvcNalPrefixSEI  = 23
+	vvcNalReserved26 = 26
+	vvcNalUnspec28   = 28
+	vvcNalUnspec29   = 29
+)
+
+// VVCParser turns a VVC Annex B byte stream into access units. Every access
+// unit starts with an access unit delimiter, IRAP access units (IDR and CRA)
+// are preceded by the last seen VPS, SPS and PPS and flagged with IsKey.
+type VVCParser struct {
+	accessUnitParser
+}
+
+func NewVVCParser(pid uint16) *VVCParser {
+	return &VVCParser{newAccessUnitParser(pid, vvcSyntax{})}
+}
+
+type vvcSyntax struct{}
+
+func vvcNalType(nal []byte) uint8 {
+	if len(nal) < 2 {
+		return 0xff
+	}
+
+	return nal[1] >> 3
+}
+
+// startsAccessUnit follows 7.4.2.4.3, a slice carrying the picture header
+// starts a new picture, otherwise the picture header NAL unit does.
+func (s vvcSyntax) startsAccessUnit(nal []byte) bool {
+	switch nalType := vvcNalType(nal); {
+	case s.isVCL(nal):
+		return len(nal) > 2 && nal[2]&0x80 != 0
+	case nalType >= vvcNalOPI && nalType <= vvcNalPrefixAPS, nalType == vvcNalPH, nalType == vvcNalAUD,
+		nalType == vvcNalPrefixSEI, nalType == vvcNalReserved26, nalType == vvcNalUnspec28, nalType == vvcNalUnspec29:
+		return true
+	}
+
+	return false
+}
+
+func (vvcSyntax) isVCL(nal []byte) bool {
+	return vvcNalType(nal) < vvcNalOPI
+}
+
+// isRandomAccess reports IRAP pictures, which are IDR and CRA.
+func (vvcSyntax) isRandomAccess(nal []byte) bool {
+	nalType := vvcNalType(nal)
+	return nalType >= vvcNalIDRWRADL && nalType <= vvcNalCRA
+}
+
+func (vvcSyntax) isDelimiter(nal []byte) bool {
+	return vvcNalType(nal) == vvcNalAUD
+}
+
+// delimiter has aud_pic_type 2, which allows any slice type, and
+// aud_irap_or_gdr_flag set for random access points.
+func (vvcSyntax) delimiter(isRandomAccess bool) []byte {
+	if isRandomAccess {
+		return []byte{0, vvcNalAUD<<3 | 1, 0xa8}
+	}
+
+	return []byte{0, vvcNalAUD<<3 | 1, 0x28}
+}
+
+// parameterSet reads the ids which open VPS, SPS and PPS.
+func (vvcSyntax) parameterSet(nal []byte) (int, uint32, bool) {
+	if len(nal) < 3 {
+		return 0, 0, false
+	}
+
+	switch vvcNalType(nal) {
+	case vvcNalVPS:
+		return 0, uint32(nal[2] >> 4), true
+	case vvcNalSPS:
+		return 1, uint32(nal[2] >> 4), true
+	case vvcNalPPS:
+		return 2, uint32(nal[2] >> 2), true
+	}
+
+	return 0, 0, false
+}
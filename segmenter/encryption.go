@@ -0,0 +1,276 @@
+package segmenter
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mpegts/muxer"
+	"mpegts/ts"
+)
+
+const (
+	EncryptionNone = iota
+	// EncryptionAES128 encrypts whole segments with AES-128-CBC and PKCS7
+	// padding.
+	EncryptionAES128
+	// EncryptionSampleAES encrypts the NAL units of H.264 and the ADTS
+	// frames of AAC streams, everything else stays in the clear.
+	EncryptionSampleAES
+)
+
+var ErrInvalidKey = errors.New("invalid key")
+
+// Key is the key material of a segment.
+type Key struct {
+	// Key is the 16 byte AES-128 key.
+	Key []byte
+	// URI is where players fetch the key from.
+	URI string
+	// IV is the 16 byte initialization vector, the media sequence number
+	// of the segment is used when nil.
+	IV []byte
+}
+
+// KeyProvider supplies the key of every segment, it may rotate keys at any
+// segment.
+type KeyProvider interface {
+	SegmentKey(sequence uint64) (*Key, error)
+}
+
+// StaticKeyProvider encrypts all segments with the same key.
+type StaticKeyProvider struct {
+	Key []byte
+	URI string
+}
+
+func (p *StaticKeyProvider) SegmentKey(uint64) (*Key, error) {
+	return &Key{Key: p.Key, URI: p.URI}, nil
+}
+
+// segmentKey is the key material of a segment as announced in the playlist.
+type segmentKey struct {
+	method string
+	uri    string
+	iv     []byte
+	block  cipher.Block
+}
+
+func (k *segmentKey) tag() string {
+	return fmt.Sprintf("#EXT-X-KEY:METHOD=%s,URI=%q,IV=0x%s", k.method, k.uri, hex.EncodeToString(k.iv))
+}
+
+func newSegmentKey(method int, key *Key, sequence uint64) (*segmentKey, error) {
+	if key == nil || key.URI == "" || (key.IV != nil && len(key.IV) != aes.BlockSize) {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key.Key)
+	if err != nil || len(key.Key) != 16 {
+		return nil, ErrInvalidKey
+	}
+
+	k := &segmentKey{
+		method: "AES-128",
+		uri:    key.URI,
+		iv:     key.IV,
+		block:  block,
+	}
+	if method == EncryptionSampleAES {
+		k.method = "SAMPLE-AES"
+	}
+	if k.iv == nil {
+		k.iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(k.iv[8:], sequence)
+	}
+
+	return k, nil
+}
+
+// cbcWriter encrypts everything written to it with AES-128-CBC and pads the
+// last block on Close.
+type cbcWriter struct {
+	w       io.WriteCloser
+	mode    cipher.BlockMode
+	pending []byte
+}
+
+func newCBCWriter(w io.WriteCloser, key *segmentKey) *cbcWriter {
+	return &cbcWriter{
+		w:    w,
+		mode: cipher.NewCBCEncrypter(key.block, key.iv),
+	}
+}
+
+func (c *cbcWriter) Write(b []byte) (int, error) {
+	c.pending = append(c.pending, b...)
+
+	n := len(c.pending) - len(c.pending)%aes.BlockSize
+	if n == 0 {
+		return len(b), nil
+	}
+
+	out := make([]byte, n)
+	c.mode.CryptBlocks(out, c.pending[:n])
+	c.pending = append(c.pending[:0], c.pending[n:]...)
+
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *cbcWriter) Close() error {
+	padding := aes.BlockSize - len(c.pending)
+	last := append(c.pending, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	c.mode.CryptBlocks(last, last)
+
+	_, err := c.w.Write(last)
+	if closeErr := c.w.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// sampleAESStreams switches H.264 and AAC streams to their SAMPLE-AES
+// stream types and adds the descriptors announcing the encryption. The
+// returned map holds the original stream type by pid.
+func sampleAESStreams(streams []*muxer.StreamMeta, audioConfigs map[uint16][]byte) ([]*muxer.StreamMeta, map[uint16]uint8) {
+	encrypted := make(map[uint16]uint8)
+	result := make([]*muxer.StreamMeta, 0, len(streams))
+
+	for _, stream := range streams {
+		switch stream.StreamTypeId {
+		case ts.StreamTypeVideoH264:
+			s := *stream
+			s.StreamTypeId = ts.StreamTypeVideoH264Encrypted
+			s.Descriptors = append([]*ts.Descriptor{ts.NewPrivateDataIndicatorDescriptor(ts.PrivateDataIndicatorAVC)}, stream.Descriptors...)
+			encrypted[s.Pid] = stream.StreamTypeId
+			stream = &s
+		case ts.StreamTypeAudioAac:
+			s := *stream
+			s.StreamTypeId = ts.StreamTypeAudioAacEncrypted
+			s.Descriptors = append([]*ts.Descriptor{
+				ts.NewPrivateDataIndicatorDescriptor(ts.PrivateDataIndicatorAAC),
+				ts.NewRegistrationDescriptor(ts.FormatIdentifierAPAD, audioSetupInformation(audioConfigs[s.Pid])),
+			}, stream.Descriptors...)
+			encrypted[s.Pid] = stream.StreamTypeId
+			stream = &s
+		}
+
+		result = append(result, stream)
+	}
+
+	return result, encrypted
+}
+
+// audioSetupInformation describes AAC-LC with the AudioSpecificConfig as
+// setup data.
+func audioSetupInformation(audioConfig []byte) []byte {
+	buf := make([]byte, 8, 8+len(audioConfig))
+	copy(buf, "zaac")
+	// priming and version stay zero
+	buf[7] = uint8(len(audioConfig))
+
+	return append(buf, audioConfig...)
+}
+
+// encryptSamples returns an encrypted copy of a frame of a SAMPLE-AES
+// stream, CBC starts over with the segment IV for every NAL unit and frame.
+func encryptSamples(data []byte, streamType uint8, key *segmentKey) []byte {
+	if streamType == ts.StreamTypeAudioAac {
+		return encryptADTS(data, key)
+	}
+
+	return encryptNALUnits(data, key)
+}
+
+// encryptNALUnits encrypts coded slices longer than 48 bytes, leaving 32
+// bytes in the clear and then encrypting one of every ten 16 byte blocks.
+// Emulation prevention is removed before and reapplied after encryption.
+func encryptNALUnits(data []byte, key *segmentKey) []byte {
+	out := make([]byte, 0, len(data)+len(data)/64)
+
+	pos := 0
+	for pos < len(data) {
+		start, end := nextNALUnit(data, pos)
+		out = append(out, data[pos:start]...)
+		pos = end
+
+		nal := data[start:end]
+		if len(nal) == 0 {
+			continue
+		}
+		if nalType := nal[0] & 0x1f; len(nal) <= 48 || (nalType != 1 && nalType != 5) {
+			out = append(out, nal...)
+			continue
+		}
+
+		rbsp := muxer.RemoveEmulationPrevention(nal)
+		mode := cipher.NewCBCEncrypter(key.block, key.iv)
+		for i := 32; len(rbsp)-i > aes.BlockSize; i += aes.BlockSize + 144 {
+			mode.CryptBlocks(rbsp[i:i+aes.BlockSize], rbsp[i:i+aes.BlockSize])
+		}
+		out = append(out, muxer.AddEmulationPrevention(rbsp)...)
+	}
+
+	return out
+}
+
+// nextNALUnit returns the bounds of the first NAL unit behind a start code
+// at or after pos, trailing zero bytes belong to the next start code or are
+// trailing_zero_8bits.
+func nextNALUnit(data []byte, pos int) (int, int) {
+	start := bytes.Index(data[pos:], []byte{0, 0, 1})
+	if start < 0 {
+		return len(data), len(data)
+	}
+	start += pos + 3
+
+	end := bytes.Index(data[start:], []byte{0, 0, 1})
+	if end < 0 {
+		end = len(data)
+	} else {
+		end += start
+	}
+	for end > start && data[end-1] == 0 {
+		end--
+	}
+
+	return start, end
+}
+
+// encryptADTS encrypts the whole 16 byte blocks of every ADTS frame behind
+// the header and a 16 byte clear leader.
+func encryptADTS(data []byte, key *segmentKey) []byte {
+	out := bytes.Clone(data)
+
+	for pos := 0; pos+7 <= len(out) && out[pos] == 0xff && out[pos+1]&0xf0 == 0xf0; {
+		frameLength := int(out[pos+3]&0x03)<<11 | int(out[pos+4])<<3 | int(out[pos+5])>>5
+		if frameLength < 7 || pos+frameLength > len(out) {
+			break
+		}
+
+		headerLength := 7
+		if out[pos+1]&0x01 == 0 {
+			headerLength = 9
+		}
+
+		if start := pos + headerLength + 16; start < pos+frameLength {
+			payload := out[start : pos+frameLength]
+			if n := len(payload) - len(payload)%aes.BlockSize; n > 0 {
+				cipher.NewCBCEncrypter(key.block, key.iv).CryptBlocks(payload[:n], payload[:n])
+			}
+		}
+
+		pos += frameLength
+	}
+
+	return out
+}
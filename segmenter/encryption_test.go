@@ -0,0 +1,285 @@
+package segmenter
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"mpegts/muxer"
+	"mpegts/ts"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testKey = &Key{
+	Key: []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+	URI: "https://example.com/key",
+	IV:  []byte{0x0f, 0x0e, 0x0d, 0x0c, 0x0b, 0x0a, 0x09, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x00},
+}
+
+func newTestKey(t *testing.T) *segmentKey {
+	t.Helper()
+
+	key, err := newSegmentKey(EncryptionSampleAES, testKey, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// sample returns n bytes without zeros, so no emulation prevention applies.
+func sample(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7)%251 + 1 + seed
+	}
+
+	return b
+}
+
+// encryptedBlocks returns the offsets of the 16 byte blocks SAMPLE-AES
+// encrypts in a NAL unit of n bytes.
+func encryptedBlocks(n int) []int {
+	var offsets []int
+	for i := 32; n-i > aes.BlockSize; i += 160 {
+		offsets = append(offsets, i)
+	}
+
+	return offsets
+}
+
+// decryptNALUnit reverses the pattern encryption of one NAL unit with CBC
+// starting over from the IV.
+func decryptNALUnit(nal []byte) []byte {
+	block, _ := aes.NewCipher(testKey.Key)
+	mode := cipher.NewCBCDecrypter(block, testKey.IV)
+
+	rbsp := muxer.RemoveEmulationPrevention(nal)
+	for _, i := range encryptedBlocks(len(rbsp)) {
+		mode.CryptBlocks(rbsp[i:i+aes.BlockSize], rbsp[i:i+aes.BlockSize])
+	}
+
+	return rbsp
+}
+
+func TestEncryptNALUnitsPattern(t *testing.T) {
+	slice := append([]byte{0x65}, sample(599, 0)...)
+	sps := append([]byte{0x67}, sample(63, 1)...)
+	short := append([]byte{0x41}, sample(47, 2)...)
+
+	var data []byte
+	for _, nal := range [][]byte{sps, slice, short, slice} {
+		data = append(data, 0, 0, 0, 1)
+		data = append(data, nal...)
+	}
+
+	encrypted := encryptNALUnits(data, newTestKey(t))
+	if len(encrypted) != len(data) {
+		t.Fatalf("length %d, want %d", len(encrypted), len(data))
+	}
+
+	var nals [][]byte
+	for pos := 0; pos < len(encrypted); {
+		start, end := nextNALUnit(encrypted, pos)
+		nals = append(nals, encrypted[start:end])
+		pos = end
+	}
+	if len(nals) != 4 {
+		t.Fatalf("%d nal units", len(nals))
+	}
+
+	if !bytes.Equal(nals[0], sps) || !bytes.Equal(nals[2], short) {
+		t.Error("sps or short slice changed")
+	}
+
+	// CBC starts over for every NAL unit
+	if !bytes.Equal(nals[1], nals[3]) {
+		t.Error("identical slices encrypt differently")
+	}
+
+	// 32 clear bytes, then one of ten blocks until 16 bytes or less remain
+	offsets := encryptedBlocks(len(slice))
+	if !slices.Equal(offsets, []int{32, 192, 352, 512}) {
+		t.Fatalf("encrypted blocks at %v", offsets)
+	}
+	for i := 0; i < len(slice); i += aes.BlockSize {
+		end := min(i+aes.BlockSize, len(slice))
+		isEncrypted := len(offsets) > 0 && offsets[0] == i
+		if isEncrypted {
+			offsets = offsets[1:]
+		}
+		if changed := !bytes.Equal(nals[1][i:end], slice[i:end]); changed != isEncrypted {
+			t.Errorf("block at %d changed %v, want %v", i, changed, isEncrypted)
+		}
+	}
+
+	if decrypted := decryptNALUnit(nals[1]); !bytes.Equal(decrypted, slice) {
+		t.Errorf("decrypted slice differs:\n got % x\nwant % x", decrypted, slice)
+	}
+}
+
+func TestEncryptNALUnitsEmulationPrevention(t *testing.T) {
+	rbsp := append([]byte{0x65}, sample(400, 0)...)
+	// zeros in clear and encrypted blocks alike
+	copy(rbsp[10:], []byte{0, 0, 1})
+	copy(rbsp[40:], []byte{0, 0, 0, 0})
+	nal := muxer.AddEmulationPrevention(rbsp)
+
+	data := append([]byte{0, 0, 0, 1}, nal...)
+	encrypted := encryptNALUnits(data, newTestKey(t))
+
+	start, end := nextNALUnit(encrypted, 0)
+	if bytes.Contains(encrypted[start:end], []byte{0, 0, 1}) || bytes.Contains(encrypted[start:end], []byte{0, 0, 0}) {
+		t.Fatal("start code emulation in encrypted nal unit")
+	}
+
+	if decrypted := decryptNALUnit(encrypted[start:end]); !bytes.Equal(decrypted, rbsp) {
+		t.Errorf("decrypted slice differs:\n got % x\nwant % x", decrypted, rbsp)
+	}
+}
+
+func adtsFrame(payload []byte) []byte {
+	frameLength := 7 + len(payload)
+	header := []byte{0xff, 0xf1, 0x50, 0x80 | byte(frameLength>>11), byte(frameLength >> 3), byte(frameLength<<5) | 0x1f, 0xfc}
+
+	return append(header, payload...)
+}
+
+func TestEncryptADTS(t *testing.T) {
+	payload := sample(16+3*aes.BlockSize+5, 0)
+	frame := adtsFrame(payload)
+	data := append(bytes.Clone(frame), frame...)
+
+	encrypted := encryptSamples(data, ts.StreamTypeAudioAac, newTestKey(t))
+	if len(encrypted) != len(data) {
+		t.Fatalf("length %d, want %d", len(encrypted), len(data))
+	}
+
+	first, second := encrypted[:len(frame)], encrypted[len(frame):]
+
+	// CBC starts over for every frame
+	if !bytes.Equal(first, second) {
+		t.Error("identical frames encrypt differently")
+	}
+
+	// header, clear leader and trailing partial block stay in the clear
+	if !bytes.Equal(first[:7+16], frame[:7+16]) || !bytes.Equal(first[len(frame)-5:], frame[len(frame)-5:]) {
+		t.Error("clear bytes changed")
+	}
+
+	encryptedPart := first[7+16 : len(frame)-5]
+	if bytes.Equal(encryptedPart, frame[7+16:len(frame)-5]) {
+		t.Fatal("frame not encrypted")
+	}
+
+	block, _ := aes.NewCipher(testKey.Key)
+	decrypted := make([]byte, len(encryptedPart))
+	cipher.NewCBCDecrypter(block, testKey.IV).CryptBlocks(decrypted, encryptedPart)
+	if !bytes.Equal(decrypted, payload[16:len(payload)-5]) {
+		t.Errorf("decrypted frame differs:\n got % x\nwant % x", decrypted, payload[16:len(payload)-5])
+	}
+}
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error {
+	return nil
+}
+
+func TestCBCWriter(t *testing.T) {
+	for _, n := range []int{0, 15, 16, 100} {
+		out := &bufferCloser{}
+		w := newCBCWriter(out, newTestKey(t))
+
+		plain := sample(n, 0)
+		for i := 0; i < n; i += 7 {
+			if _, err := w.Write(plain[i:min(i+7, n)]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		encrypted := out.Bytes()
+		if len(encrypted) != (n/aes.BlockSize+1)*aes.BlockSize {
+			t.Fatalf("%d bytes encrypt to %d", n, len(encrypted))
+		}
+
+		block, _ := aes.NewCipher(testKey.Key)
+		decrypted := make([]byte, len(encrypted))
+		cipher.NewCBCDecrypter(block, testKey.IV).CryptBlocks(decrypted, encrypted)
+
+		padding := int(decrypted[len(decrypted)-1])
+		if padding < 1 || padding > aes.BlockSize || !bytes.Equal(decrypted[:len(decrypted)-padding], plain) {
+			t.Errorf("%d bytes decrypt to % x", n, decrypted)
+		}
+	}
+}
+
+func TestSegmentKeyIV(t *testing.T) {
+	key, err := newSegmentKey(EncryptionAES128, &Key{Key: testKey.Key, URI: testKey.URI}, 0x0102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "#EXT-X-KEY:METHOD=AES-128,URI=\"https://example.com/key\",IV=0x00000000000000000000000000000102"
+	if key.tag() != want {
+		t.Errorf("got %s, want %s", key.tag(), want)
+	}
+}
+
+func TestSampleAESPacksAAC(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Config{
+		Dir:            dir,
+		PlaylistType:   PlaylistVOD,
+		TargetDuration: time.Second,
+		Encryption:     EncryptionSampleAES,
+		KeyProvider:    &StaticKeyProvider{Key: testKey.Key, URI: testKey.URI},
+		Muxer: muxer.Config{
+			PmtPid: 0x1000,
+			PcrPid: 0x101,
+			Streams: []*muxer.StreamMeta{{
+				Pid:          0x101,
+				StreamId:     0xc0,
+				StreamTypeId: ts.StreamTypeAudioAac,
+				PESDuration:  100 * time.Millisecond,
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 44.1 kHz frames last 2089 ticks, four of them fit into 100 ms
+	frame := adtsFrame(sample(16+3*aes.BlockSize, 0))
+	for i := range 20 {
+		if err := s.WriteFrame(&muxer.StreamPacket{Data: frame, Pid: 0x101, Pts: int64(i) * 2089, Dts: muxer.NoPts, IsHead: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "segment0.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pes := 0
+	for i := 0; i+ts.PacketSize <= len(b); i += ts.PacketSize {
+		if pid := uint16(b[i+1]&0x1f)<<8 | uint16(b[i+2]); pid == 0x101 && b[i+1]&0x40 != 0 {
+			pes++
+		}
+	}
+	if pes != 5 {
+		t.Errorf("%d PES, want 5", pes)
+	}
+}
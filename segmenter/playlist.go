@@ -0,0 +1,127 @@
+package segmenter
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	PlaylistLive = iota
+	PlaylistEvent
+	PlaylistVOD
+)
+
+type segment struct {
+	sequence uint64
+	name     string
+	duration time.Duration
+	// key is nil for segments in the clear.
+	key *segmentKey
+}
+
+type playlist struct {
+	path           string
+	playlistType   int
+	windowSize     int
+	targetDuration time.Duration
+	segments       []*segment
+}
+
+// add appends a finished segment and returns segments which dropped out of
+// the live window.
+func (p *playlist) add(s *segment) []*segment {
+	p.segments = append(p.segments, s)
+
+	if p.playlistType != PlaylistLive || p.windowSize <= 0 || len(p.segments) <= p.windowSize {
+		return nil
+	}
+
+	removed := p.segments[:len(p.segments)-p.windowSize]
+	p.segments = p.segments[len(p.segments)-p.windowSize:]
+
+	return removed
+}
+
+func (p *playlist) encode(isFinished bool) []byte {
+	target := int(math.Ceil(p.targetDuration.Seconds()))
+	for _, s := range p.segments {
+		target = max(target, int(math.Round(s.duration.Seconds())))
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("#EXTM3U\n")
+	// SAMPLE-AES needs version 5
+	version := 3
+	for _, s := range p.segments {
+		if s.key != nil && s.key.method == "SAMPLE-AES" {
+			version = 5
+		}
+	}
+	fmt.Fprintf(buf, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(buf, "#EXT-X-TARGETDURATION:%d\n", target)
+
+	sequence := uint64(0)
+	if len(p.segments) > 0 {
+		sequence = p.segments[0].sequence
+	}
+	fmt.Fprintf(buf, "#EXT-X-MEDIA-SEQUENCE:%d\n", sequence)
+
+	switch p.playlistType {
+	case PlaylistEvent:
+		buf.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	case PlaylistVOD:
+		buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	}
+
+	lastKey := "#EXT-X-KEY:METHOD=NONE"
+	for _, s := range p.segments {
+		key := "#EXT-X-KEY:METHOD=NONE"
+		if s.key != nil {
+			key = s.key.tag()
+		}
+		if key != lastKey {
+			buf.WriteString(key)
+			buf.WriteString("\n")
+			lastKey = key
+		}
+
+		fmt.Fprintf(buf, "#EXTINF:%.3f,\n", s.duration.Seconds())
+		buf.WriteString(s.name)
+		buf.WriteString("\n")
+	}
+
+	if isFinished {
+		buf.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	return buf.Bytes()
+}
+
+// write replaces the playlist file atomically so that readers never see a
+// partial playlist.
+func (p *playlist) write(isFinished bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), "."+filepath.Base(p.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(p.encode(isFinished))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+
+	return err
+}
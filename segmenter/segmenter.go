@@ -0,0 +1,307 @@
+package segmenter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mpegts/id3"
+	"mpegts/klv"
+	"mpegts/muxer"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const DefaultSegmentName = "segment%d.ts"
+const DefaultPlaylistName = "index.m3u8"
+
+type Config struct {
+	Dir string
+	// SegmentName is a fmt pattern receiving the media sequence number,
+	// DefaultSegmentName is used when empty.
+	SegmentName string
+	// PlaylistName is the media playlist file in Dir, DefaultPlaylistName
+	// is used when empty.
+	PlaylistName string
+	// PlaylistType is one of PlaylistLive, PlaylistEvent or PlaylistVOD. A
+	// VOD playlist is written on Close only.
+	PlaylistType int
+	// TargetDuration is the minimum segment duration, a segment is cut at
+	// the first keyframe after it.
+	TargetDuration time.Duration
+	// WindowSize is the number of segments listed by a live playlist, zero
+	// lists all of them.
+	WindowSize int
+	// DeleteSegments removes segment files dropped from the live window.
+	DeleteSegments bool
+	// KeyPid selects the stream whose keyframes start segments, the PCR PID
+	// of the first program is used when zero.
+	KeyPid uint16
+	// Encryption is one of EncryptionNone, EncryptionAES128 or
+	// EncryptionSampleAES.
+	Encryption int
+	// KeyProvider supplies the keys of encrypted segments.
+	KeyProvider KeyProvider
+	// AudioConfigs holds the AudioSpecificConfig of AAC streams by pid,
+	// SAMPLE-AES announces it in the PMT.
+	AudioConfigs map[uint16][]byte
+	Muxer        muxer.Config
+}
+
+type Segmenter struct {
+	dir            string
+	segmentName    string
+	targetDuration int64
+	deleteSegments bool
+	keyPid         uint16
+	encryption     int
+	keyProvider    KeyProvider
+	sampleAES      map[uint16]uint8
+	muxer          *muxer.Muxer
+	playlist       *playlist
+	current        *segment
+	startDts       int64
+	hasStartDts    bool
+	endDts         int64
+	lastDts        map[uint16]int64
+	closed         bool
+}
+
+func New(cfg Config) (*Segmenter, error) {
+	if cfg.TargetDuration <= 0 {
+		return nil, errors.New("invalid target duration")
+	}
+
+	if cfg.PlaylistType != PlaylistLive && cfg.PlaylistType != PlaylistEvent && cfg.PlaylistType != PlaylistVOD {
+		return nil, errors.New("invalid playlist type")
+	}
+
+	if cfg.WindowSize < 0 {
+		return nil, errors.New("invalid window size")
+	}
+
+	if cfg.Encryption != EncryptionNone && cfg.Encryption != EncryptionAES128 && cfg.Encryption != EncryptionSampleAES {
+		return nil, errors.New("invalid encryption")
+	}
+
+	if cfg.Encryption != EncryptionNone && cfg.KeyProvider == nil {
+		return nil, errors.New("missing key provider")
+	}
+
+	if cfg.SegmentName == "" {
+		cfg.SegmentName = DefaultSegmentName
+	}
+	if cfg.PlaylistName == "" {
+		cfg.PlaylistName = DefaultPlaylistName
+	}
+
+	s := &Segmenter{
+		dir:            cfg.Dir,
+		segmentName:    cfg.SegmentName,
+		targetDuration: toTicks(cfg.TargetDuration),
+		deleteSegments: cfg.DeleteSegments,
+		keyPid:         cfg.KeyPid,
+		encryption:     cfg.Encryption,
+		keyProvider:    cfg.KeyProvider,
+		lastDts:        make(map[uint16]int64),
+		playlist: &playlist{
+			path:           filepath.Join(cfg.Dir, cfg.PlaylistName),
+			playlistType:   cfg.PlaylistType,
+			windowSize:     cfg.WindowSize,
+			targetDuration: cfg.TargetDuration,
+		},
+	}
+
+	if s.keyPid == 0 {
+		s.keyPid = cfg.Muxer.PcrPid
+		if len(cfg.Muxer.Programs) > 0 {
+			s.keyPid = cfg.Muxer.Programs[0].PcrPid
+		}
+	}
+
+	if cfg.Encryption == EncryptionSampleAES {
+		cfg.Muxer.Streams, s.sampleAES = sampleAESStreams(cfg.Muxer.Streams, cfg.AudioConfigs)
+	}
+
+	f, err := s.createSegment(0)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Muxer.Splitter = s
+	s.muxer, err = muxer.New(f, cfg.Muxer)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(filepath.Join(s.dir, s.current.name))
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// WriteFrame passes a frame to the muxer, keyframes of KeyPid are expected
+// to be flagged with IsKey. With SAMPLE-AES every frame of an H.264 or AAC
+// stream has to be a head packet holding whole NAL units or ADTS frames.
+func (s *Segmenter) WriteFrame(sp *muxer.StreamPacket) error {
+	if _, exists := s.sampleAES[sp.Pid]; exists {
+		if !sp.IsHead {
+			return errors.New("partial frame of encrypted stream")
+		}
+
+		// encryption replaces the data once the segment is known
+		frame := *sp
+		sp = &frame
+	}
+
+	return s.muxer.WriteFrame(sp)
+}
+
+// WriteMetadata passes timed ID3 metadata to the muxer.
+func (s *Segmenter) WriteMetadata(pid uint16, pts int64, frames ...*id3.Frame) error {
+	return s.muxer.WriteMetadata(pid, pts, frames...)
+}
+
+// WriteKLV passes KLV triplets to the muxer.
+func (s *Segmenter) WriteKLV(pid uint16, pts int64, triplets ...*klv.Triplet) error {
+	return s.muxer.WriteKLV(pid, pts, triplets...)
+}
+
+// Close finishes the last segment and writes the final playlist with
+// EXT-X-ENDLIST.
+func (s *Segmenter) Close() error {
+	if s.closed {
+		return muxer.ErrClosed
+	}
+	s.closed = true
+
+	err := s.muxer.Close()
+
+	s.current.duration = toDuration(s.endDts - s.startDts)
+	for _, removed := range s.playlist.add(s.current) {
+		s.removeSegment(removed)
+	}
+
+	if writeErr := s.playlist.write(true); err == nil {
+		err = writeErr
+	}
+
+	return err
+}
+
+// Split implements muxer.Splitter, it starts a new segment at the first
+// keyframe of KeyPid once the current segment reached the target duration.
+// SAMPLE-AES frames are encrypted here with the key of their segment.
+func (s *Segmenter) Split(sp *muxer.StreamPacket) (io.WriteCloser, error) {
+	w, err := s.split(sp)
+	if err != nil {
+		return nil, err
+	}
+
+	if streamType, exists := s.sampleAES[sp.Pid]; exists {
+		sp.Data = encryptSamples(sp.Data, streamType, s.current.key)
+	}
+
+	return w, nil
+}
+
+func (s *Segmenter) split(sp *muxer.StreamPacket) (io.WriteCloser, error) {
+	if sp.Pts == muxer.NoPts {
+		return nil, nil
+	}
+
+	dts := sp.DecodingTs()
+	s.trackEnd(sp.Pid, dts)
+
+	if !s.hasStartDts {
+		s.startDts = dts
+		s.hasStartDts = true
+		return nil, nil
+	}
+
+	if sp.Pid != s.keyPid || !sp.IsKey || dts-s.startDts < s.targetDuration {
+		return nil, nil
+	}
+
+	s.current.duration = toDuration(dts - s.startDts)
+	for _, removed := range s.playlist.add(s.current) {
+		s.removeSegment(removed)
+	}
+
+	if s.playlist.playlistType != PlaylistVOD {
+		if err := s.playlist.write(false); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := s.createSegment(s.current.sequence + 1)
+	if err != nil {
+		return nil, err
+	}
+	s.startDts = dts
+
+	return f, nil
+}
+
+// trackEnd estimates where the stream ends, assuming the last frame of
+// each stream lasts as long as the one before it.
+func (s *Segmenter) trackEnd(pid uint16, dts int64) {
+	end := dts
+	if last, exists := s.lastDts[pid]; exists && dts > last {
+		end = dts + dts - last
+	}
+	s.lastDts[pid] = dts
+
+	if end > s.endDts {
+		s.endDts = end
+	}
+}
+
+func (s *Segmenter) createSegment(sequence uint64) (io.WriteCloser, error) {
+	var key *segmentKey
+	if s.encryption != EncryptionNone {
+		k, err := s.keyProvider.SegmentKey(sequence)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err = newSegmentKey(s.encryption, k, sequence)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := fmt.Sprintf(s.segmentName, sequence)
+
+	f, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	s.current = &segment{
+		sequence: sequence,
+		name:     name,
+		key:      key,
+	}
+
+	if s.encryption == EncryptionAES128 {
+		return newCBCWriter(f, key), nil
+	}
+
+	return f, nil
+}
+
+func (s *Segmenter) removeSegment(seg *segment) {
+	if s.deleteSegments {
+		_ = os.Remove(filepath.Join(s.dir, seg.name))
+	}
+}
+
+// toTicks converts d to the 90 kHz clock, rounding up like the muxer so
+// that segments are not cut before the target duration.
+func toTicks(d time.Duration) int64 {
+	return (d.Nanoseconds()*9 + 99999) / 100000
+}
+
+func toDuration(ticks int64) time.Duration {
+	return time.Duration(max(ticks, 0)) * time.Second / 90000
+}
@@ -0,0 +1,165 @@
+package ts
+
+const (
+	DescriptorTagAC3         = 0x6a
+	DescriptorTagEnhancedAC3 = 0x7a
+)
+
+// AC3Descriptor is the DVB AC-3_descriptor, fields are only present when
+// their flag is set.
+type AC3Descriptor struct {
+	ComponentTypeFlag bool
+	BsidFlag          bool
+	MainidFlag        bool
+	AsvcFlag          bool
+	ComponentType     uint8
+	Bsid              uint8
+	Mainid            uint8
+	Asvc              uint8
+	AdditionalInfo    []byte
+}
+
+// EnhancedAC3Descriptor is the DVB enhanced_AC-3_descriptor, the E prefix
+// keeps its fields apart from AC3Descriptor.
+type EnhancedAC3Descriptor struct {
+	EComponentTypeFlag bool
+	EBsidFlag          bool
+	EMainidFlag        bool
+	EAsvcFlag          bool
+	MixinfoExists      bool
+	Substream1Flag     bool
+	Substream2Flag     bool
+	Substream3Flag     bool
+	EComponentType     uint8
+	EBsid              uint8
+	EMainid            uint8
+	EAsvc              uint8
+	Substream1         uint8
+	Substream2         uint8
+	Substream3         uint8
+	EAdditionalInfo    []byte
+}
+
+func NewAC3Descriptor(ac3 *AC3Descriptor) *Descriptor {
+	return &Descriptor{
+		DescriptorTag: DescriptorTagAC3,
+		Type:          DescriptorTagAC3,
+		AC3Descriptor: ac3,
+	}
+}
+
+func NewEnhancedAC3Descriptor(eac3 *EnhancedAC3Descriptor) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:         DescriptorTagEnhancedAC3,
+		Type:                  DescriptorTagEnhancedAC3,
+		EnhancedAC3Descriptor: eac3,
+	}
+}
+
+func (ac3 *AC3Descriptor) encode() []byte {
+	flags := []bool{ac3.ComponentTypeFlag, ac3.BsidFlag, ac3.MainidFlag, ac3.AsvcFlag}
+	values := []uint8{ac3.ComponentType, ac3.Bsid, ac3.Mainid, ac3.Asvc}
+
+	buf := encodeAC3Fields(0x0f, flags, values, -1)
+
+	return append(buf, ac3.AdditionalInfo...)
+}
+
+func (eac3 *EnhancedAC3Descriptor) encode() []byte {
+	flags := []bool{eac3.EComponentTypeFlag, eac3.EBsidFlag, eac3.EMainidFlag, eac3.EAsvcFlag,
+		eac3.MixinfoExists, eac3.Substream1Flag, eac3.Substream2Flag, eac3.Substream3Flag}
+	values := []uint8{eac3.EComponentType, eac3.EBsid, eac3.EMainid, eac3.EAsvc,
+		0, eac3.Substream1, eac3.Substream2, eac3.Substream3}
+
+	// mixinfoexists has no field of its own
+	buf := encodeAC3Fields(0, flags, values, 4)
+
+	return append(buf, eac3.EAdditionalInfo...)
+}
+
+// encodeAC3Fields writes the flag byte followed by the values whose flag is
+// set, the flag at index skip has no value.
+func encodeAC3Fields(reserved uint8, flags []bool, values []uint8, skip int) []byte {
+	buf := []byte{reserved}
+	for i, flag := range flags {
+		if flag {
+			buf[0] |= 0x80 >> i
+		}
+	}
+
+	for i, flag := range flags {
+		if flag && i != skip {
+			buf = append(buf, values[i])
+		}
+	}
+
+	return buf
+}
+
+// decodeAC3Fields is the reverse of encodeAC3Fields and returns the values
+// and the additional info behind them.
+func decodeAC3Fields(b []byte, flags int, skip int) ([]uint8, []byte, bool) {
+	if len(b) < 1 {
+		return nil, nil, false
+	}
+
+	values := make([]uint8, flags)
+	pos := 1
+	for i := 0; i < flags; i++ {
+		if b[0]&(0x80>>i) == 0 || i == skip {
+			continue
+		}
+		if pos >= len(b) {
+			return nil, nil, false
+		}
+		values[i] = b[pos]
+		pos++
+	}
+
+	return values, b[pos:], true
+}
+
+func decodeAC3Descriptor(b []byte) *AC3Descriptor {
+	values, additionalInfo, ok := decodeAC3Fields(b, 4, -1)
+	if !ok {
+		return nil
+	}
+
+	return &AC3Descriptor{
+		ComponentTypeFlag: b[0]&0x80 != 0,
+		BsidFlag:          b[0]&0x40 != 0,
+		MainidFlag:        b[0]&0x20 != 0,
+		AsvcFlag:          b[0]&0x10 != 0,
+		ComponentType:     values[0],
+		Bsid:              values[1],
+		Mainid:            values[2],
+		Asvc:              values[3],
+		AdditionalInfo:    additionalInfo,
+	}
+}
+
+func decodeEnhancedAC3Descriptor(b []byte) *EnhancedAC3Descriptor {
+	values, additionalInfo, ok := decodeAC3Fields(b, 8, 4)
+	if !ok {
+		return nil
+	}
+
+	return &EnhancedAC3Descriptor{
+		EComponentTypeFlag: b[0]&0x80 != 0,
+		EBsidFlag:          b[0]&0x40 != 0,
+		EMainidFlag:        b[0]&0x20 != 0,
+		EAsvcFlag:          b[0]&0x10 != 0,
+		MixinfoExists:      b[0]&0x08 != 0,
+		Substream1Flag:     b[0]&0x04 != 0,
+		Substream2Flag:     b[0]&0x02 != 0,
+		Substream3Flag:     b[0]&0x01 != 0,
+		EComponentType:     values[0],
+		EBsid:              values[1],
+		EMainid:            values[2],
+		EAsvc:              values[3],
+		Substream1:         values[5],
+		Substream2:         values[6],
+		Substream3:         values[7],
+		EAdditionalInfo:    additionalInfo,
+	}
+}
@@ -86,6 +86,27 @@ func (a *AdaptationField) Encode() []byte {
 	return buf
 }
 
+// SetPCR stores a 27 MHz clock value as 33 bit base and 9 bit extension.
+func (a *AdaptationField) SetPCR(pcr uint64) {
+	base := (pcr / 300) & 0x1ffffffff
+	ext := pcr % 300
+
+	a.PCR[0] = uint8(base >> 25)
+	a.PCR[1] = uint8(base >> 17)
+	a.PCR[2] = uint8(base >> 9)
+	a.PCR[3] = uint8(base >> 1)
+	a.PCR[4] = uint8(base&0x1)<<7 | 0x7e | uint8(ext>>8)&0x1
+	a.PCR[5] = uint8(ext)
+}
+
+// GetPCR returns PCR as 27 MHz clock value.
+func (a *AdaptationField) GetPCR() uint64 {
+	base := uint64(a.PCR[0])<<25 | uint64(a.PCR[1])<<17 | uint64(a.PCR[2])<<9 | uint64(a.PCR[3])<<1 | uint64(a.PCR[4]>>7)
+	ext := uint64(a.PCR[4]&0x1)<<8 | uint64(a.PCR[5])
+
+	return base*300 + ext
+}
+
 func DecodeAdaptationField(adfControl uint8, b []byte) *AdaptationField {
 	adf := &AdaptationField{}
 	adf.Type = adfControl
@@ -0,0 +1,83 @@
+package ts
+
+// FormatIdentifierAV01 identifies AV1 video in private data streams.
+const FormatIdentifierAV01 uint32 = 0x41563031
+
+// DescriptorTagAV1Video is the user private tag of the AV1 video descriptor,
+// which is recognized by its marker and version.
+const DescriptorTagAV1Video = 0x80
+
+// AV1VideoDescriptor mirrors the first four bytes of the
+// AV1CodecConfigurationRecord with hdr_wcg_idc in place of reserved bits.
+type AV1VideoDescriptor struct {
+	// Version is 1 for the current specification.
+	Version                          uint8
+	SeqProfile                       uint8
+	SeqLevelIdx0                     uint8
+	SeqTier0                         bool
+	HighBitdepth                     bool
+	TwelveBit                        bool
+	Monochrome                       bool
+	ChromaSubsamplingX               bool
+	ChromaSubsamplingY               bool
+	ChromaSamplePosition             uint8
+	HdrWcgIdc                        uint8
+	InitialPresentationDelayPresent  bool
+	InitialPresentationDelayMinusOne uint8
+}
+
+func NewAV1VideoDescriptor(av1 *AV1VideoDescriptor) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:      DescriptorTagAV1Video,
+		Type:               DescriptorTagAV1Video,
+		AV1VideoDescriptor: av1,
+	}
+}
+
+// NewAV1VideoDescriptorFromConfig takes an AV1CodecConfigurationRecord as
+// found in av1C boxes and CodecPrivate of Matroska.
+func NewAV1VideoDescriptorFromConfig(config []byte) (*Descriptor, error) {
+	if len(config) < 4 || config[0] != 0x81 {
+		return nil, ErrInvalidDescriptor
+	}
+
+	return NewAV1VideoDescriptor(decodeAV1VideoDescriptor(config)), nil
+}
+
+func (av1 *AV1VideoDescriptor) encode() []byte {
+	buf := make([]byte, 4)
+	buf[0] = 0x80 | av1.Version&0x7f
+	buf[1] = av1.SeqProfile<<5 | av1.SeqLevelIdx0&0x1f
+
+	for i, flag := range []bool{av1.SeqTier0, av1.HighBitdepth, av1.TwelveBit, av1.Monochrome, av1.ChromaSubsamplingX, av1.ChromaSubsamplingY} {
+		if flag {
+			buf[2] |= 0x80 >> i
+		}
+	}
+	buf[2] |= av1.ChromaSamplePosition & 0x3
+
+	buf[3] = av1.HdrWcgIdc << 6
+	if av1.InitialPresentationDelayPresent {
+		buf[3] |= 0x10 | av1.InitialPresentationDelayMinusOne&0xf
+	}
+
+	return buf
+}
+
+func decodeAV1VideoDescriptor(b []byte) *AV1VideoDescriptor {
+	return &AV1VideoDescriptor{
+		Version:                          b[0] & 0x7f,
+		SeqProfile:                       b[1] >> 5,
+		SeqLevelIdx0:                     b[1] & 0x1f,
+		SeqTier0:                         b[2]&0x80 != 0,
+		HighBitdepth:                     b[2]&0x40 != 0,
+		TwelveBit:                        b[2]&0x20 != 0,
+		Monochrome:                       b[2]&0x10 != 0,
+		ChromaSubsamplingX:               b[2]&0x08 != 0,
+		ChromaSubsamplingY:               b[2]&0x04 != 0,
+		ChromaSamplePosition:             b[2] & 0x3,
+		HdrWcgIdc:                        b[3] >> 6,
+		InitialPresentationDelayPresent:  b[3]&0x10 != 0,
+		InitialPresentationDelayMinusOne: b[3] & 0xf,
+	}
+}
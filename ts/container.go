@@ -9,6 +9,9 @@ type Container struct {
 	pmtPIDs         []uint16
 	audioStreamPIDs []uint16
 	videoStreamPIDs []uint16
+	scte35PIDs      []uint16
+	opusPIDs        []uint16
+	klvPIDs         map[uint16]int
 }
 
 func NewContainer() *Container {
@@ -71,6 +74,18 @@ func (c *Container) DecodePacket(b []byte) (*Packet, error) {
 				if !slices.Contains(c.audioStreamPIDs, stream.ElementaryPID) {
 					c.audioStreamPIDs = append(c.audioStreamPIDs, stream.ElementaryPID)
 				}
+				if stream.isOpus() && !slices.Contains(c.opusPIDs, stream.ElementaryPID) {
+					c.opusPIDs = append(c.opusPIDs, stream.ElementaryPID)
+				}
+			} else if stream.StreamType == StreamTypeSCTE35 {
+				if !slices.Contains(c.scte35PIDs, stream.ElementaryPID) {
+					c.scte35PIDs = append(c.scte35PIDs, stream.ElementaryPID)
+				}
+			} else if mode := stream.klvMode(); mode != KLVNone {
+				if c.klvPIDs == nil {
+					c.klvPIDs = make(map[uint16]int)
+				}
+				c.klvPIDs[stream.ElementaryPID] = mode
 			}
 		}
 	}
@@ -78,6 +93,23 @@ func (c *Container) DecodePacket(b []byte) (*Packet, error) {
 	return ts, nil
 }
 
+// GetKLVMode reports how pid carries KLV according to the PMTs decoded so
+// far. Synchronous KLV PES payloads are metadata AU cells, see
+// DecodeMetadataAUCells, asynchronous ones hold the triplets directly.
+func (c *Container) GetKLVMode(pid uint16) int {
+	if mode, exists := c.klvPIDs[pid]; exists {
+		return mode
+	}
+
+	return KLVNone
+}
+
+// IsOpus reports whether pid carries Opus according to the PMTs decoded so
+// far, its PES payloads are decoded by DecodeOpusAccessUnits.
+func (c *Container) IsOpus(pid uint16) bool {
+	return slices.Contains(c.opusPIDs, pid)
+}
+
 func (c *Container) addAudioStreamPID(pid uint16) {
 	c.audioStreamPIDs = append(c.audioStreamPIDs, pid)
 }
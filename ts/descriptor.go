@@ -1,26 +1,150 @@
 package ts
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	DescriptorTagVideo                = 2
+	DescriptorTagAudio                = 3
+	DescriptorTagRegistration         = 5
+	DescriptorTagVideoWindow          = 8
+	DescriptorTagMpeg4Video           = 27
+	DescriptorTagMpeg4Audio           = 28
+	DescriptorAvcVideo                = 40
+	DescriptorAvcTimingAndHrdVideo    = 42
+	DescriptorTagIso639Language       = 10
+	DescriptorTagSystemClock          = 11
+	DescriptorTagMaximumBitrate       = 14
+	DescriptorTagPrivateDataIndicator = 15
+	DescriptorTagMetadataPointer      = 37
+	DescriptorTagMetadata             = 38
+	DescriptorTagService              = 0x48
+	DescriptorTagExtension            = 0x7f
+)
 
 const (
-	DescriptorTagVideo             = 2
-	DescriptorTagAudio             = 3
-	DescriptorTagVideoWindow       = 8
-	DescriptorTagMpeg4Video        = 27
-	DescriptorTagMpeg4Audio        = 28
-	DescriptorAvcVideo             = 40
-	DescriptorAvcTimingAndHrdVideo = 42
-	DescriptorTagIso639Language    = 10
-	DescriptorTagSystemClock       = 11
-	DescriptorTagMaximumBitrate    = 14
+	ServiceTypeDigitalTelevision         = 0x01
+	ServiceTypeDigitalRadio              = 0x02
+	ServiceTypeAdvancedCodecSDTelevision = 0x16
+	ServiceTypeAdvancedCodecHDTelevision = 0x19
+	ServiceTypeHEVCTelevision            = 0x1f
 )
 
+var ErrInvalidDescriptor = errors.New("invalid descriptor")
+
 type Descriptor struct {
 	DescriptorTag    uint8
 	DescriptorLength uint8
 	*AVCVideoDescriptor
 	*AVCTimingAndHRDDescriptor
+	*ISO639LanguageDescriptor
+	*RegistrationDescriptor
+	*MaximumBitrateDescriptor
+	*PrivateDataIndicatorDescriptor
+	*ServiceDescriptor
+	*MetadataPointerDescriptor
+	*MetadataDescriptor
+	*ExtensionDescriptor
+	*AV1VideoDescriptor
+	*VVCVideoDescriptor
+	*AC3Descriptor
+	*EnhancedAC3Descriptor
 	Type uint8
+	// Data holds the body of descriptors without a dedicated structure.
+	Data []byte
+}
+
+type ISO639LanguageDescriptor struct {
+	Languages []*ISO639Language
+}
+
+type ISO639Language struct {
+	Code      string
+	AudioType uint8
+}
+
+type RegistrationDescriptor struct {
+	FormatIdentifier             uint32
+	AdditionalIdentificationInfo []byte
+}
+
+type MaximumBitrateDescriptor struct {
+	// MaximumBitrate is measured in units of 50 bytes per second.
+	MaximumBitrate uint32
+}
+
+type PrivateDataIndicatorDescriptor struct {
+	PrivateDataIndicator uint32
+}
+
+// Private data indicators and the registration of the audio setup of HLS
+// SAMPLE-AES encrypted streams.
+const (
+	PrivateDataIndicatorAVC uint32 = 0x7a617663 // zavc
+	PrivateDataIndicatorAAC uint32 = 0x61616364 // aacd
+	FormatIdentifierAPAD    uint32 = 0x61706164 // apad
+)
+
+// FormatIdentifierID3 identifies timed ID3 metadata in metadata descriptors.
+const FormatIdentifierID3 uint32 = 0x49443320
+
+// MetadataApplicationFormatIdentifier and MetadataFormatIdentifier are the
+// format values announcing that a format identifier field follows.
+const (
+	MetadataApplicationFormatIdentifier = 0xffff
+	MetadataFormatIdentifier            = 0xff
+)
+
+// MetadataPointerDescriptor points from program_info to the metadata
+// service of a program.
+type MetadataPointerDescriptor struct {
+	MetadataApplicationFormat           uint16
+	MetadataApplicationFormatIdentifier uint32
+	MetadataFormat                      uint8
+	MetadataFormatIdentifier            uint32
+	MetadataServiceId                   uint8
+	MetadataLocatorRecordFlag           bool
+	MPEGCarriageFlags                   uint8
+	MetadataLocatorRecord               []byte
+	ProgramNumber                       uint16
+	TransportStreamLocation             uint16
+	TransportStreamId                   uint16
+	PrivateData                         []byte
+}
+
+// MetadataDescriptor describes the metadata carried by a metadata stream.
+type MetadataDescriptor struct {
+	MetadataApplicationFormat           uint16
+	MetadataApplicationFormatIdentifier uint32
+	MetadataFormat                      uint8
+	MetadataFormatIdentifier            uint32
+	MetadataServiceId                   uint8
+	DecoderConfigFlags                  uint8
+	DSMCCFlag                           bool
+	ServiceIdentificationRecord         []byte
+	// DecoderConfig holds decoder_config_byte for flags 1,
+	// dec_config_identification_record_byte for flags 3 and reserved_data
+	// for flags 5 and 6.
+	DecoderConfig                  []byte
+	DecoderConfigMetadataServiceId uint8
+	PrivateData                    []byte
+}
+
+// ServiceDescriptor is the DVB service_descriptor of SDT, names beyond ASCII
+// are written as UTF-8 with its character table selector.
+type ServiceDescriptor struct {
+	ServiceType         uint8
+	ServiceProviderName string
+	ServiceName         string
+}
+
+// ExtensionDescriptor is the DVB extension_descriptor, its body depends on
+// DescriptorTagExtension.
+type ExtensionDescriptor struct {
+	DescriptorTagExtension uint8
+	Selector               []byte
 }
 
 type AVCVideoDescriptor struct {
@@ -67,49 +191,183 @@ type VideoDescriptor struct {
 	Reserved                  uint8
 }
 
+func NewISO639LanguageDescriptor(languages ...*ISO639Language) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:            DescriptorTagIso639Language,
+		Type:                     DescriptorTagIso639Language,
+		ISO639LanguageDescriptor: &ISO639LanguageDescriptor{Languages: languages},
+	}
+}
+
+func NewRegistrationDescriptor(formatIdentifier uint32, additionalInfo []byte) *Descriptor {
+	return &Descriptor{
+		DescriptorTag: DescriptorTagRegistration,
+		Type:          DescriptorTagRegistration,
+		RegistrationDescriptor: &RegistrationDescriptor{
+			FormatIdentifier:             formatIdentifier,
+			AdditionalIdentificationInfo: additionalInfo,
+		},
+	}
+}
+
+// NewMaximumBitrateDescriptor takes the bitrate in bits per second.
+func NewMaximumBitrateDescriptor(bitrate uint32) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:            DescriptorTagMaximumBitrate,
+		Type:                     DescriptorTagMaximumBitrate,
+		MaximumBitrateDescriptor: &MaximumBitrateDescriptor{MaximumBitrate: (bitrate + 399) / 400},
+	}
+}
+
+func NewPrivateDataIndicatorDescriptor(indicator uint32) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:                  DescriptorTagPrivateDataIndicator,
+		Type:                           DescriptorTagPrivateDataIndicator,
+		PrivateDataIndicatorDescriptor: &PrivateDataIndicatorDescriptor{PrivateDataIndicator: indicator},
+	}
+}
+
+func NewServiceDescriptor(serviceType uint8, providerName string, serviceName string) *Descriptor {
+	return &Descriptor{
+		DescriptorTag: DescriptorTagService,
+		Type:          DescriptorTagService,
+		ServiceDescriptor: &ServiceDescriptor{
+			ServiceType:         serviceType,
+			ServiceProviderName: providerName,
+			ServiceName:         serviceName,
+		},
+	}
+}
+
+func NewMetadataPointerDescriptor(pointer *MetadataPointerDescriptor) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:             DescriptorTagMetadataPointer,
+		Type:                      DescriptorTagMetadataPointer,
+		MetadataPointerDescriptor: pointer,
+	}
+}
+
+func NewMetadataDescriptor(metadata *MetadataDescriptor) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:      DescriptorTagMetadata,
+		Type:               DescriptorTagMetadata,
+		MetadataDescriptor: metadata,
+	}
+}
+
+func NewExtensionDescriptor(tagExtension uint8, selector []byte) *Descriptor {
+	return &Descriptor{
+		DescriptorTag: DescriptorTagExtension,
+		Type:          DescriptorTagExtension,
+		ExtensionDescriptor: &ExtensionDescriptor{
+			DescriptorTagExtension: tagExtension,
+			Selector:               selector,
+		},
+	}
+}
+
+// NewOpusDescriptor announces the channel configuration of an Opus stream,
+// see OpusChannelConfigDualMono.
+func NewOpusDescriptor(channelConfigCode uint8) *Descriptor {
+	return NewExtensionDescriptor(DescriptorTagExtensionOpus, []byte{channelConfigCode})
+}
+
+func NewAVCVideoDescriptor(avc *AVCVideoDescriptor) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:      DescriptorAvcVideo,
+		Type:               DescriptorAvcVideo,
+		AVCVideoDescriptor: avc,
+	}
+}
+
+// NewRawDescriptor carries data as body of a descriptor with any tag.
+func NewRawDescriptor(tag uint8, data []byte) *Descriptor {
+	return &Descriptor{
+		DescriptorTag: tag,
+		Data:          data,
+	}
+}
+
+// Validate checks that the descriptor body fits into its 8 bit length.
+func (d *Descriptor) Validate() error {
+	if len(d.encodeBody()) > 0xff {
+		return ErrInvalidDescriptor
+	}
+
+	if d.ISO639LanguageDescriptor != nil {
+		for _, l := range d.ISO639LanguageDescriptor.Languages {
+			if len(l.Code) != 3 {
+				return ErrInvalidDescriptor
+			}
+		}
+	}
+
+	return nil
+}
+
 func (d *Descriptor) encode() []byte {
-	buf := make([]byte, 2+d.DescriptorLength)
+	body := d.encodeBody()
+	d.DescriptorLength = uint8(len(body))
+
+	buf := make([]byte, 2+len(body))
 	buf[0] = d.DescriptorTag
 	buf[1] = d.DescriptorLength
+	copy(buf[2:], body)
+
+	return buf
+}
 
-	switch d.DescriptorTag {
-	case DescriptorAvcVideo:
-		buf[2] = d.ProfileIdc
+func (d *Descriptor) encodeBody() []byte {
+	switch {
+	case d.DescriptorTag == DescriptorAvcVideo && d.AVCVideoDescriptor != nil:
+		buf := make([]byte, 4)
+		buf[0] = d.ProfileIdc
 		if d.AVCVideoDescriptor.ConstraintSet0Flag {
-			buf[3] |= 0x80
+			buf[1] |= 0x80
 		}
 		if d.AVCVideoDescriptor.ConstraintSet1Flag {
-			buf[3] |= 0x40
+			buf[1] |= 0x40
 		}
 		if d.AVCVideoDescriptor.ConstraintSet2Flag {
-			buf[3] |= 0x20
+			buf[1] |= 0x20
 		}
 		if d.AVCVideoDescriptor.ConstraintSet3Flag {
-			buf[3] |= 0x10
+			buf[1] |= 0x10
 		}
 		if d.AVCVideoDescriptor.ConstraintSet4Flag {
-			buf[3] |= 0x8
+			buf[1] |= 0x8
 		}
 		if d.AVCVideoDescriptor.ConstraintSet5Flag {
-			buf[3] |= 0x4
+			buf[1] |= 0x4
 		}
-		buf[3] |= d.AVCVideoDescriptor.AVCCompatibleFlags & 0x03
+		buf[1] |= d.AVCVideoDescriptor.AVCCompatibleFlags & 0x03
 
-		buf[4] = d.AVCVideoDescriptor.LevelIdc
+		buf[2] = d.AVCVideoDescriptor.LevelIdc
 
 		if d.AVCVideoDescriptor.AVCStillPresent {
-			buf[5] |= 0x80
+			buf[3] |= 0x80
 		}
 		if d.AVCVideoDescriptor.AVC24HourPictureFlag {
-			buf[5] |= 0x40
+			buf[3] |= 0x40
 		}
 		if d.AVCVideoDescriptor.FramePackingSEINotPresentFLag {
-			buf[5] |= 0x20
+			buf[3] |= 0x20
+		}
+		buf[3] |= d.AVCVideoDescriptor.Reserved & 0x1f
+
+		return buf
+
+	case d.DescriptorTag == DescriptorAvcTimingAndHrdVideo && d.AVCTimingAndHRDDescriptor != nil:
+		length := 2
+		if d.AVCTimingAndHRDDescriptor.PictureAndTimingInfoPresent {
+			length += 5
+			if !d.AVCTimingAndHRDDescriptor.Hz90rFlag {
+				length += 8
+			}
 		}
-		buf[5] |= d.AVCVideoDescriptor.Reserved & 0x1f
 
-	case DescriptorAvcTimingAndHrdVideo:
-		counter := NewCounterOffset(2)
+		buf := make([]byte, length)
+		counter := NewCounter[int]()
 		if d.AVCTimingAndHRDDescriptor.HrdManagementValidFlag {
 			buf[counter.Current()] |= 0x40
 		}
@@ -145,9 +403,118 @@ func (d *Descriptor) encode() []byte {
 			buf[counter.Current()] |= 0x20
 		}
 		buf[counter.Current()] |= d.AVCTimingAndHRDDescriptor.Reserved3
+
+		return buf
+
+	case d.DescriptorTag == DescriptorTagIso639Language && d.ISO639LanguageDescriptor != nil:
+		buf := make([]byte, 4*len(d.ISO639LanguageDescriptor.Languages))
+		for i, l := range d.ISO639LanguageDescriptor.Languages {
+			copy(buf[i*4:i*4+3], l.Code)
+			buf[i*4+3] = l.AudioType
+		}
+
+		return buf
+
+	case d.DescriptorTag == DescriptorTagRegistration && d.RegistrationDescriptor != nil:
+		buf := make([]byte, 4+len(d.RegistrationDescriptor.AdditionalIdentificationInfo))
+		binary.BigEndian.PutUint32(buf, d.RegistrationDescriptor.FormatIdentifier)
+		copy(buf[4:], d.RegistrationDescriptor.AdditionalIdentificationInfo)
+
+		return buf
+
+	case d.DescriptorTag == DescriptorTagMaximumBitrate && d.MaximumBitrateDescriptor != nil:
+		buf := make([]byte, 3)
+		buf[0] = 0xc0 | uint8(d.MaximumBitrateDescriptor.MaximumBitrate>>16)&0x3f
+		buf[1] = uint8(d.MaximumBitrateDescriptor.MaximumBitrate >> 8)
+		buf[2] = uint8(d.MaximumBitrateDescriptor.MaximumBitrate)
+
+		return buf
+
+	case d.DescriptorTag == DescriptorTagPrivateDataIndicator && d.PrivateDataIndicatorDescriptor != nil:
+		buf := make([]byte, 4)
+		binary.BigEndian.PutUint32(buf, d.PrivateDataIndicatorDescriptor.PrivateDataIndicator)
+
+		return buf
+
+	case d.DescriptorTag == DescriptorTagMetadataPointer && d.MetadataPointerDescriptor != nil:
+		mp := d.MetadataPointerDescriptor
+		buf := encodeMetadataFormat(mp.MetadataApplicationFormat, mp.MetadataApplicationFormatIdentifier, mp.MetadataFormat, mp.MetadataFormatIdentifier)
+		buf = append(buf, mp.MetadataServiceId)
+
+		flags := uint8(0x1f) | (mp.MPEGCarriageFlags&0x3)<<5
+		if mp.MetadataLocatorRecordFlag {
+			flags |= 0x80
+		}
+		buf = append(buf, flags)
+
+		if mp.MetadataLocatorRecordFlag {
+			buf = append(buf, uint8(len(mp.MetadataLocatorRecord)))
+			buf = append(buf, mp.MetadataLocatorRecord...)
+		}
+		if mp.MPEGCarriageFlags <= 2 {
+			buf = binary.BigEndian.AppendUint16(buf, mp.ProgramNumber)
+		}
+		if mp.MPEGCarriageFlags == 1 {
+			buf = binary.BigEndian.AppendUint16(buf, mp.TransportStreamLocation)
+			buf = binary.BigEndian.AppendUint16(buf, mp.TransportStreamId)
+		}
+
+		return append(buf, mp.PrivateData...)
+
+	case d.DescriptorTag == DescriptorTagMetadata && d.MetadataDescriptor != nil:
+		md := d.MetadataDescriptor
+		buf := encodeMetadataFormat(md.MetadataApplicationFormat, md.MetadataApplicationFormatIdentifier, md.MetadataFormat, md.MetadataFormatIdentifier)
+		buf = append(buf, md.MetadataServiceId)
+
+		flags := uint8(0x0f) | (md.DecoderConfigFlags&0x7)<<5
+		if md.DSMCCFlag {
+			flags |= 0x10
+		}
+		buf = append(buf, flags)
+
+		if md.DSMCCFlag {
+			buf = append(buf, uint8(len(md.ServiceIdentificationRecord)))
+			buf = append(buf, md.ServiceIdentificationRecord...)
+		}
+		switch md.DecoderConfigFlags {
+		case 1, 3, 5, 6:
+			buf = append(buf, uint8(len(md.DecoderConfig)))
+			buf = append(buf, md.DecoderConfig...)
+		case 4:
+			buf = append(buf, md.DecoderConfigMetadataServiceId)
+		}
+
+		return append(buf, md.PrivateData...)
+
+	case d.DescriptorTag == DescriptorTagVVCVideo && d.VVCVideoDescriptor != nil:
+		return d.VVCVideoDescriptor.encode()
+
+	case d.DescriptorTag == DescriptorTagAV1Video && d.AV1VideoDescriptor != nil:
+		return d.AV1VideoDescriptor.encode()
+
+	case d.DescriptorTag == DescriptorTagAC3 && d.AC3Descriptor != nil:
+		return d.AC3Descriptor.encode()
+
+	case d.DescriptorTag == DescriptorTagEnhancedAC3 && d.EnhancedAC3Descriptor != nil:
+		return d.EnhancedAC3Descriptor.encode()
+
+	case d.DescriptorTag == DescriptorTagExtension && d.ExtensionDescriptor != nil:
+		return append([]byte{d.ExtensionDescriptor.DescriptorTagExtension}, d.ExtensionDescriptor.Selector...)
+
+	case d.DescriptorTag == DescriptorTagService && d.ServiceDescriptor != nil:
+		providerName := encodeDVBString(d.ServiceDescriptor.ServiceProviderName)
+		serviceName := encodeDVBString(d.ServiceDescriptor.ServiceName)
+
+		buf := make([]byte, 0, 3+len(providerName)+len(serviceName))
+		buf = append(buf, d.ServiceDescriptor.ServiceType, uint8(len(providerName)))
+		buf = append(buf, providerName...)
+		buf = append(buf, uint8(len(serviceName)))
+		buf = append(buf, serviceName...)
+
+		return buf
 	}
 
-	return buf
+	return d.Data
 }
 
 func DecodeDescriptors(b []byte) []*Descriptor {
@@ -162,45 +529,143 @@ func DecodeDescriptors(b []byte) []*Descriptor {
 		d.DescriptorTag = b[counter.Next()]
 		d.DescriptorLength = b[counter.Next()]
 
-		switch d.DescriptorTag {
-		case DescriptorAvcVideo:
+		if counter.Current()+int(d.DescriptorLength) > len(b) {
+			break
+		}
+		body := b[counter.Current() : counter.Current()+int(d.DescriptorLength)]
+		counter.Seek(int(d.DescriptorLength))
+
+		switch {
+		case d.DescriptorTag == DescriptorAvcVideo && len(body) >= 4:
 			d.Type = DescriptorAvcVideo
 			d.AVCVideoDescriptor = &AVCVideoDescriptor{}
-			d.AVCVideoDescriptor.ProfileIdc = b[counter.Next()]
-			d.AVCVideoDescriptor.ConstraintSet0Flag = b[counter.Next()]&0x80 != 0
-			d.AVCVideoDescriptor.ConstraintSet1Flag = b[counter.Next()]&0x40 != 0
-			d.AVCVideoDescriptor.ConstraintSet2Flag = b[counter.Next()]&0x20 != 0
-			d.AVCVideoDescriptor.ConstraintSet3Flag = b[counter.Next()]&0x10 != 0
-			d.AVCVideoDescriptor.ConstraintSet4Flag = b[counter.Next()]&0x8 != 0
-			d.AVCVideoDescriptor.ConstraintSet5Flag = b[counter.Next()]&0x4 != 0
-			d.AVCVideoDescriptor.AVCCompatibleFlags = b[counter.Next()] & 0x3
-			d.AVCVideoDescriptor.LevelIdc = b[counter.Next()]
-			d.AVCVideoDescriptor.AVCStillPresent = b[counter.Next()]&0x80 != 0
-			d.AVCVideoDescriptor.AVC24HourPictureFlag = b[counter.Next()]&0x40 != 0
-			d.AVCVideoDescriptor.FramePackingSEINotPresentFLag = b[counter.Next()]&0x20 != 0
+			d.AVCVideoDescriptor.ProfileIdc = body[0]
+			d.AVCVideoDescriptor.ConstraintSet0Flag = body[1]&0x80 != 0
+			d.AVCVideoDescriptor.ConstraintSet1Flag = body[1]&0x40 != 0
+			d.AVCVideoDescriptor.ConstraintSet2Flag = body[1]&0x20 != 0
+			d.AVCVideoDescriptor.ConstraintSet3Flag = body[1]&0x10 != 0
+			d.AVCVideoDescriptor.ConstraintSet4Flag = body[1]&0x8 != 0
+			d.AVCVideoDescriptor.ConstraintSet5Flag = body[1]&0x4 != 0
+			d.AVCVideoDescriptor.AVCCompatibleFlags = body[1] & 0x3
+			d.AVCVideoDescriptor.LevelIdc = body[2]
+			d.AVCVideoDescriptor.AVCStillPresent = body[3]&0x80 != 0
+			d.AVCVideoDescriptor.AVC24HourPictureFlag = body[3]&0x40 != 0
+			d.AVCVideoDescriptor.FramePackingSEINotPresentFLag = body[3]&0x20 != 0
 			d.AVCVideoDescriptor.Reserved = 0
-		case DescriptorAvcTimingAndHrdVideo:
+		case d.DescriptorTag == DescriptorAvcTimingAndHrdVideo && len(body) >= 2:
 			d.Type = DescriptorAvcTimingAndHrdVideo
 			d.AVCTimingAndHRDDescriptor = &AVCTimingAndHRDDescriptor{}
-			d.AVCTimingAndHRDDescriptor.HrdManagementValidFlag = b[counter.Next()]&0x80 != 0
-			d.AVCTimingAndHRDDescriptor.Reserved = (b[counter.Next()] >> 1) & 0x3f
-			d.AVCTimingAndHRDDescriptor.PictureAndTimingInfoPresent = b[counter.Next()]&0x1 != 0
+			bodyCounter := NewCounter[int]()
+			d.AVCTimingAndHRDDescriptor.HrdManagementValidFlag = body[bodyCounter.Current()]&0x80 != 0
+			d.AVCTimingAndHRDDescriptor.Reserved = (body[bodyCounter.Current()] >> 1) & 0x3f
+			d.AVCTimingAndHRDDescriptor.PictureAndTimingInfoPresent = body[bodyCounter.Next()]&0x1 != 0
 			if d.AVCTimingAndHRDDescriptor.PictureAndTimingInfoPresent {
-				d.AVCTimingAndHRDDescriptor.Hz90rFlag = b[counter.Next()]&0x80 != 0
-				d.AVCTimingAndHRDDescriptor.Reserved2 = b[counter.Next()] & 0x7f
-				if d.AVCTimingAndHRDDescriptor.Hz90rFlag {
-					d.AVCTimingAndHRDDescriptor.N = binary.BigEndian.Uint32(b[counter.Next() : counter.Current()+4])
-					counter.Seek(4)
-					d.AVCTimingAndHRDDescriptor.K = binary.BigEndian.Uint32(b[counter.Next() : counter.Current()+4])
-					counter.Seek(3)
+				if len(body) < 7 {
+					break
 				}
-				d.AVCTimingAndHRDDescriptor.FixedFrameRateFlag = b[counter.Next()]&0x80 != 0
-				d.AVCTimingAndHRDDescriptor.TemporalPocFlag = b[counter.Next()]&0x40 != 0
-				d.AVCTimingAndHRDDescriptor.PictureToDisplayConversionFlag = b[counter.Next()]&0x20 != 0
-				d.AVCTimingAndHRDDescriptor.Reserved3 = b[counter.Next()] & 0x1f
+				d.AVCTimingAndHRDDescriptor.Hz90rFlag = body[bodyCounter.Current()]&0x80 != 0
+				d.AVCTimingAndHRDDescriptor.Reserved2 = body[bodyCounter.Next()] & 0x7f
+				if !d.AVCTimingAndHRDDescriptor.Hz90rFlag {
+					if len(body) < 15 {
+						break
+					}
+					d.AVCTimingAndHRDDescriptor.N = binary.BigEndian.Uint32(body[bodyCounter.Current():])
+					bodyCounter.Seek(4)
+					d.AVCTimingAndHRDDescriptor.K = binary.BigEndian.Uint32(body[bodyCounter.Current():])
+					bodyCounter.Seek(4)
+				}
+				d.AVCTimingAndHRDDescriptor.NumUnitsInTick = binary.BigEndian.Uint32(body[bodyCounter.Current():])
+				bodyCounter.Seek(4)
+			}
+			d.AVCTimingAndHRDDescriptor.FixedFrameRateFlag = body[bodyCounter.Current()]&0x80 != 0
+			d.AVCTimingAndHRDDescriptor.TemporalPocFlag = body[bodyCounter.Current()]&0x40 != 0
+			d.AVCTimingAndHRDDescriptor.PictureToDisplayConversionFlag = body[bodyCounter.Current()]&0x20 != 0
+			d.AVCTimingAndHRDDescriptor.Reserved3 = body[bodyCounter.Current()] & 0x1f
+		case d.DescriptorTag == DescriptorTagIso639Language:
+			d.Type = DescriptorTagIso639Language
+			d.ISO639LanguageDescriptor = &ISO639LanguageDescriptor{}
+			for i := 0; i+4 <= len(body); i += 4 {
+				d.ISO639LanguageDescriptor.Languages = append(d.ISO639LanguageDescriptor.Languages, &ISO639Language{
+					Code:      string(body[i : i+3]),
+					AudioType: body[i+3],
+				})
+			}
+		case d.DescriptorTag == DescriptorTagRegistration && len(body) >= 4:
+			d.Type = DescriptorTagRegistration
+			d.RegistrationDescriptor = &RegistrationDescriptor{
+				FormatIdentifier:             binary.BigEndian.Uint32(body),
+				AdditionalIdentificationInfo: body[4:],
+			}
+		case d.DescriptorTag == DescriptorTagMaximumBitrate && len(body) >= 3:
+			d.Type = DescriptorTagMaximumBitrate
+			d.MaximumBitrateDescriptor = &MaximumBitrateDescriptor{
+				MaximumBitrate: uint32(body[0]&0x3f)<<16 | uint32(body[1])<<8 | uint32(body[2]),
+			}
+		case d.DescriptorTag == DescriptorTagPrivateDataIndicator && len(body) >= 4:
+			d.Type = DescriptorTagPrivateDataIndicator
+			d.PrivateDataIndicatorDescriptor = &PrivateDataIndicatorDescriptor{
+				PrivateDataIndicator: binary.BigEndian.Uint32(body),
+			}
+		case d.DescriptorTag == DescriptorTagMetadataPointer:
+			d.MetadataPointerDescriptor = decodeMetadataPointerDescriptor(body)
+			if d.MetadataPointerDescriptor == nil {
+				d.Data = body
+				break
+			}
+			d.Type = DescriptorTagMetadataPointer
+		case d.DescriptorTag == DescriptorTagMetadata:
+			d.MetadataDescriptor = decodeMetadataDescriptor(body)
+			if d.MetadataDescriptor == nil {
+				d.Data = body
+				break
+			}
+			d.Type = DescriptorTagMetadata
+		case d.DescriptorTag == DescriptorTagVVCVideo:
+			d.VVCVideoDescriptor = decodeVVCVideoDescriptor(body)
+			if d.VVCVideoDescriptor == nil {
+				d.Data = body
+				break
+			}
+			d.Type = DescriptorTagVVCVideo
+		case d.DescriptorTag == DescriptorTagAV1Video && len(body) == 4 && body[0] == 0x81:
+			d.Type = DescriptorTagAV1Video
+			d.AV1VideoDescriptor = decodeAV1VideoDescriptor(body)
+		case d.DescriptorTag == DescriptorTagAC3:
+			d.AC3Descriptor = decodeAC3Descriptor(body)
+			if d.AC3Descriptor == nil {
+				d.Data = body
+				break
+			}
+			d.Type = DescriptorTagAC3
+		case d.DescriptorTag == DescriptorTagEnhancedAC3:
+			d.EnhancedAC3Descriptor = decodeEnhancedAC3Descriptor(body)
+			if d.EnhancedAC3Descriptor == nil {
+				d.Data = body
+				break
+			}
+			d.Type = DescriptorTagEnhancedAC3
+		case d.DescriptorTag == DescriptorTagExtension && len(body) >= 1:
+			d.Type = DescriptorTagExtension
+			d.ExtensionDescriptor = &ExtensionDescriptor{
+				DescriptorTagExtension: body[0],
+				Selector:               body[1:],
+			}
+		case d.DescriptorTag == DescriptorTagService && len(body) >= 3:
+			providerNameLen := int(body[1])
+			if 2+providerNameLen >= len(body) || 3+providerNameLen+int(body[2+providerNameLen]) > len(body) {
+				d.Data = body
+				break
+			}
+			serviceNameLen := int(body[2+providerNameLen])
+
+			d.Type = DescriptorTagService
+			d.ServiceDescriptor = &ServiceDescriptor{
+				ServiceType:         body[0],
+				ServiceProviderName: decodeDVBString(body[2 : 2+providerNameLen]),
+				ServiceName:         decodeDVBString(body[3+providerNameLen : 3+providerNameLen+serviceNameLen]),
 			}
 		default:
-			counter.Seek(int(d.DescriptorLength) + 1)
+			d.Data = body
 		}
 
 		descriptors = append(descriptors, d)
@@ -208,3 +673,160 @@ func DecodeDescriptors(b []byte) []*Descriptor {
 
 	return descriptors
 }
+
+func encodeMetadataFormat(applicationFormat uint16, applicationFormatIdentifier uint32, format uint8, formatIdentifier uint32) []byte {
+	buf := make([]byte, 0, 16)
+	buf = binary.BigEndian.AppendUint16(buf, applicationFormat)
+	if applicationFormat == MetadataApplicationFormatIdentifier {
+		buf = binary.BigEndian.AppendUint32(buf, applicationFormatIdentifier)
+	}
+
+	buf = append(buf, format)
+	if format == MetadataFormatIdentifier {
+		buf = binary.BigEndian.AppendUint32(buf, formatIdentifier)
+	}
+
+	return buf
+}
+
+// decodeMetadataFormat reads the format fields shared by the metadata
+// descriptors and returns how many bytes they take, zero when b is short.
+func decodeMetadataFormat(b []byte) (uint16, uint32, uint8, uint32, int) {
+	counter := NewCounter[int]()
+	if len(b) < 3 {
+		return 0, 0, 0, 0, 0
+	}
+
+	applicationFormat := binary.BigEndian.Uint16(b)
+	counter.Seek(2)
+
+	applicationFormatIdentifier := uint32(0)
+	if applicationFormat == MetadataApplicationFormatIdentifier {
+		if len(b) < counter.Current()+5 {
+			return 0, 0, 0, 0, 0
+		}
+		applicationFormatIdentifier = binary.BigEndian.Uint32(b[counter.Current():])
+		counter.Seek(4)
+	}
+
+	format := b[counter.Next()]
+
+	formatIdentifier := uint32(0)
+	if format == MetadataFormatIdentifier {
+		if len(b) < counter.Current()+4 {
+			return 0, 0, 0, 0, 0
+		}
+		formatIdentifier = binary.BigEndian.Uint32(b[counter.Current():])
+		counter.Seek(4)
+	}
+
+	return applicationFormat, applicationFormatIdentifier, format, formatIdentifier, counter.Current()
+}
+
+func decodeMetadataPointerDescriptor(b []byte) *MetadataPointerDescriptor {
+	mp := &MetadataPointerDescriptor{}
+
+	var n int
+	mp.MetadataApplicationFormat, mp.MetadataApplicationFormatIdentifier, mp.MetadataFormat, mp.MetadataFormatIdentifier, n = decodeMetadataFormat(b)
+	if n == 0 || len(b) < n+2 {
+		return nil
+	}
+
+	counter := NewCounterOffset[int](n)
+	mp.MetadataServiceId = b[counter.Next()]
+	mp.MetadataLocatorRecordFlag = b[counter.Current()]&0x80 != 0
+	mp.MPEGCarriageFlags = (b[counter.Next()] >> 5) & 0x3
+
+	if mp.MetadataLocatorRecordFlag {
+		if counter.Current() >= len(b) || counter.Current()+1+int(b[counter.Current()]) > len(b) {
+			return nil
+		}
+		length := int(b[counter.Next()])
+		mp.MetadataLocatorRecord = b[counter.Current() : counter.Current()+length]
+		counter.Seek(length)
+	}
+
+	if mp.MPEGCarriageFlags <= 2 {
+		if counter.Current()+2 > len(b) {
+			return nil
+		}
+		mp.ProgramNumber = binary.BigEndian.Uint16(b[counter.Current():])
+		counter.Seek(2)
+	}
+
+	if mp.MPEGCarriageFlags == 1 {
+		if counter.Current()+4 > len(b) {
+			return nil
+		}
+		mp.TransportStreamLocation = binary.BigEndian.Uint16(b[counter.Current():])
+		mp.TransportStreamId = binary.BigEndian.Uint16(b[counter.Current()+2:])
+		counter.Seek(4)
+	}
+
+	mp.PrivateData = b[counter.Current():]
+
+	return mp
+}
+
+func decodeMetadataDescriptor(b []byte) *MetadataDescriptor {
+	md := &MetadataDescriptor{}
+
+	var n int
+	md.MetadataApplicationFormat, md.MetadataApplicationFormatIdentifier, md.MetadataFormat, md.MetadataFormatIdentifier, n = decodeMetadataFormat(b)
+	if n == 0 || len(b) < n+2 {
+		return nil
+	}
+
+	counter := NewCounterOffset[int](n)
+	md.MetadataServiceId = b[counter.Next()]
+	md.DecoderConfigFlags = b[counter.Current()] >> 5
+	md.DSMCCFlag = b[counter.Next()]&0x10 != 0
+
+	if md.DSMCCFlag {
+		if counter.Current() >= len(b) || counter.Current()+1+int(b[counter.Current()]) > len(b) {
+			return nil
+		}
+		length := int(b[counter.Next()])
+		md.ServiceIdentificationRecord = b[counter.Current() : counter.Current()+length]
+		counter.Seek(length)
+	}
+
+	switch md.DecoderConfigFlags {
+	case 1, 3, 5, 6:
+		if counter.Current() >= len(b) || counter.Current()+1+int(b[counter.Current()]) > len(b) {
+			return nil
+		}
+		length := int(b[counter.Next()])
+		md.DecoderConfig = b[counter.Current() : counter.Current()+length]
+		counter.Seek(length)
+	case 4:
+		if counter.Current() >= len(b) {
+			return nil
+		}
+		md.DecoderConfigMetadataServiceId = b[counter.Next()]
+	}
+
+	md.PrivateData = b[counter.Current():]
+
+	return md
+}
+
+// encodeDVBString prefixes text beyond ASCII with the UTF-8 character table
+// selector of EN 300 468, ASCII is valid in the default table as is.
+func encodeDVBString(s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return append([]byte{0x15}, s...)
+		}
+	}
+
+	return []byte(s)
+}
+
+func decodeDVBString(b []byte) string {
+	if len(b) > 0 && b[0] == 0x15 {
+		return string(b[1:])
+	}
+
+	return string(b)
+}
@@ -14,6 +14,7 @@ const StreamTypeVideoMpeg4 uint8 = 0x10
 const StreamTypeMetadata uint8 = 0x15
 const StreamTypeVideoH264 uint8 = 0x1b
 const StreamTypeVideoHevc uint8 = 0x24
+const StreamTypeVideoVvc uint8 = 0x33
 const StreamTypeVideoCavs uint8 = 0x42
 const StreamTypeVideoVc1 uint8 = 0xea
 const StreamTypeVideoDirac uint8 = 0xd1
@@ -21,6 +22,11 @@ const StreamTypeAudioAc3 uint8 = 0x81
 const StreamTypeAudioDts uint8 = 0x82
 const StreamTypeAudioTrueHD uint8 = 0x83
 const StreamTypeAudioEac3 uint8 = 0x87
+const StreamTypeSCTE35 uint8 = 0x86
+
+// Stream types of HLS SAMPLE-AES encrypted elementary streams.
+const StreamTypeVideoH264Encrypted uint8 = 0xdb
+const StreamTypeAudioAacEncrypted uint8 = 0xcf
 
 type ESInfo struct {
 	Streams []*Stream
@@ -69,11 +75,17 @@ func (s *Stream) encode() []byte {
 }
 
 func (s *Stream) isVideo() bool {
+	if s.isAV1() {
+		return true
+	}
+
 	switch s.StreamType {
 	case StreamTypeVideoCavs,
 		StreamTypeVideoDirac,
 		StreamTypeVideoH264,
+		StreamTypeVideoH264Encrypted,
 		StreamTypeVideoHevc,
+		StreamTypeVideoVvc,
 		StreamTypeVideoMpeg1,
 		StreamTypeVideoMpeg2,
 		StreamTypeVideoMpeg4,
@@ -85,8 +97,13 @@ func (s *Stream) isVideo() bool {
 }
 
 func (s *Stream) isAudio() bool {
+	if s.isOpus() || s.isDVBAC3() {
+		return true
+	}
+
 	switch s.StreamType {
 	case StreamTypeAudioAac,
+		StreamTypeAudioAacEncrypted,
 		StreamTypeAudioAacLatm,
 		StreamTypeAudioAc3,
 		StreamTypeAudioDts,
@@ -100,6 +117,56 @@ func (s *Stream) isAudio() bool {
 	return false
 }
 
+func (s *Stream) isOpus() bool {
+	return s.StreamType == StreamTypePrivateData && s.hasRegistration(FormatIdentifierOpus)
+}
+
+// isDVBAC3 reports AC-3 and E-AC-3 signalled the DVB way, as private data
+// with the descriptor of the codec.
+func (s *Stream) isDVBAC3() bool {
+	if s.StreamType != StreamTypePrivateData {
+		return false
+	}
+
+	for _, d := range s.Descriptors {
+		if d.DescriptorTag == DescriptorTagAC3 || d.DescriptorTag == DescriptorTagEnhancedAC3 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Stream) isAV1() bool {
+	return s.StreamType == StreamTypePrivateData && s.hasRegistration(FormatIdentifierAV01)
+}
+
+func (s *Stream) hasRegistration(formatIdentifier uint32) bool {
+	for _, d := range s.Descriptors {
+		if d.RegistrationDescriptor != nil && d.RegistrationDescriptor.FormatIdentifier == formatIdentifier {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Stream) klvMode() int {
+	for _, d := range s.Descriptors {
+		switch {
+		case s.StreamType == StreamTypeMetadata && d.MetadataDescriptor != nil &&
+			d.MetadataDescriptor.MetadataFormat == MetadataFormatIdentifier &&
+			d.MetadataDescriptor.MetadataFormatIdentifier == FormatIdentifierKLVA:
+			return KLVSync
+		case s.StreamType == StreamTypePrivateData && d.RegistrationDescriptor != nil &&
+			d.RegistrationDescriptor.FormatIdentifier == FormatIdentifierKLVA:
+			return KLVAsync
+		}
+	}
+
+	return KLVNone
+}
+
 func IsValidStreamTypeId(id uint8) bool {
 	switch id {
 	case StreamTypeVideoMpeg1,
@@ -114,13 +181,17 @@ func IsValidStreamTypeId(id uint8) bool {
 		StreamTypeMetadata,
 		StreamTypeVideoH264,
 		StreamTypeVideoHevc,
+		StreamTypeVideoVvc,
 		StreamTypeVideoCavs,
 		StreamTypeVideoVc1,
 		StreamTypeVideoDirac,
 		StreamTypeAudioAc3,
 		StreamTypeAudioDts,
 		StreamTypeAudioTrueHD,
-		StreamTypeAudioEac3:
+		StreamTypeAudioEac3,
+		StreamTypeSCTE35,
+		StreamTypeVideoH264Encrypted,
+		StreamTypeAudioAacEncrypted:
 		return true
 	}
 
@@ -0,0 +1,92 @@
+package ts
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// FormatIdentifierKLVA identifies SMPTE 336M KLV metadata.
+const FormatIdentifierKLVA uint32 = 0x4b4c5641
+
+const StreamIdMetadata uint8 = 0xfc
+
+const (
+	CellFragmentMiddle   = 0
+	CellFragmentLast     = 1
+	CellFragmentFirst    = 2
+	CellFragmentComplete = 3
+)
+
+const (
+	KLVNone = iota
+	KLVSync
+	KLVAsync
+)
+
+var ErrInvalidMetadataAUCell = errors.New("invalid metadata AU cell")
+
+// MetadataAUCell wraps metadata access units carried in metadata streams,
+// which is the PES payload of synchronous KLV.
+type MetadataAUCell struct {
+	MetadataServiceId      uint8
+	SequenceNumber         uint8
+	CellFragmentIndication uint8
+	DecoderConfigFlag      bool
+	RandomAccessIndicator  bool
+	Reserved               uint8
+	AUCellDataLength       uint16
+	Data                   []byte
+}
+
+func (c *MetadataAUCell) Encode() []byte {
+	c.AUCellDataLength = uint16(len(c.Data))
+
+	buf := make([]byte, 5+len(c.Data))
+	buf[0] = c.MetadataServiceId
+	buf[1] = c.SequenceNumber
+
+	buf[2] = (c.CellFragmentIndication & 0x3) << 6
+	if c.DecoderConfigFlag {
+		buf[2] |= 0x20
+	}
+	if c.RandomAccessIndicator {
+		buf[2] |= 0x10
+	}
+	buf[2] |= c.Reserved & 0xf
+
+	binary.BigEndian.PutUint16(buf[3:], c.AUCellDataLength)
+	copy(buf[5:], c.Data)
+
+	return buf
+}
+
+func DecodeMetadataAUCells(b []byte) ([]*MetadataAUCell, error) {
+	cells := make([]*MetadataAUCell, 0)
+
+	counter := NewCounter[int]()
+	for counter.Current() < len(b) {
+		if counter.Current()+5 > len(b) {
+			return nil, ErrInvalidMetadataAUCell
+		}
+
+		c := &MetadataAUCell{}
+		c.MetadataServiceId = b[counter.Next()]
+		c.SequenceNumber = b[counter.Next()]
+		c.CellFragmentIndication = b[counter.Current()] >> 6
+		c.DecoderConfigFlag = b[counter.Current()]&0x20 != 0
+		c.RandomAccessIndicator = b[counter.Current()]&0x10 != 0
+		c.Reserved = b[counter.Next()] & 0xf
+		c.AUCellDataLength = binary.BigEndian.Uint16(b[counter.Current():])
+		counter.Seek(2)
+
+		if counter.Current()+int(c.AUCellDataLength) > len(b) {
+			return nil, ErrInvalidMetadataAUCell
+		}
+		c.Data = b[counter.Current() : counter.Current()+int(c.AUCellDataLength)]
+		counter.Seek(int(c.AUCellDataLength))
+
+		cells = append(cells, c)
+	}
+
+	return cells, nil
+}
@@ -0,0 +1,125 @@
+package ts
+
+import "errors"
+
+// FormatIdentifierOpus identifies Opus audio in private data streams.
+const FormatIdentifierOpus uint32 = 0x4f707573
+
+// DescriptorTagExtensionOpus is the DVB extension descriptor carrying the
+// channel_config_code of Opus streams.
+const DescriptorTagExtensionOpus = 0x80
+
+// OpusChannelConfigDualMono is the channel_config_code of two independent
+// mono channels, codes up to 8 give the channel count of mapping family 0
+// and 1.
+const OpusChannelConfigDualMono = 0x80
+
+var ErrInvalidOpusAccessUnit = errors.New("invalid opus access unit")
+
+// OpusAccessUnit is an Opus packet with its opus_control_header, a PES of
+// an Opus stream holds one or more of them.
+type OpusAccessUnit struct {
+	StartTrimFlag        bool
+	EndTrimFlag          bool
+	ControlExtensionFlag bool
+	StartTrim            uint16
+	EndTrim              uint16
+	ControlExtension     []byte
+	Data                 []byte
+}
+
+func (au *OpusAccessUnit) Encode() []byte {
+	buf := make([]byte, 2, 2+len(au.Data)/255+1+4+len(au.ControlExtension)+len(au.Data))
+	buf[0] = 0x7f
+	buf[1] = 0xe0
+	if au.StartTrimFlag {
+		buf[1] |= 0x10
+	}
+	if au.EndTrimFlag {
+		buf[1] |= 0x08
+	}
+	if au.ControlExtensionFlag {
+		buf[1] |= 0x04
+	}
+
+	size := len(au.Data)
+	for ; size >= 0xff; size -= 0xff {
+		buf = append(buf, 0xff)
+	}
+	buf = append(buf, uint8(size))
+
+	if au.StartTrimFlag {
+		buf = append(buf, uint8(au.StartTrim>>8)&0x1f, uint8(au.StartTrim))
+	}
+	if au.EndTrimFlag {
+		buf = append(buf, uint8(au.EndTrim>>8)&0x1f, uint8(au.EndTrim))
+	}
+	if au.ControlExtensionFlag {
+		buf = append(buf, uint8(len(au.ControlExtension)))
+		buf = append(buf, au.ControlExtension...)
+	}
+
+	return append(buf, au.Data...)
+}
+
+func DecodeOpusAccessUnits(b []byte) ([]*OpusAccessUnit, error) {
+	units := make([]*OpusAccessUnit, 0)
+
+	counter := NewCounter[int]()
+	for counter.Current() < len(b) {
+		if counter.Current()+3 > len(b) || b[counter.Current()] != 0x7f || b[counter.Current()+1]&0xe0 != 0xe0 {
+			return nil, ErrInvalidOpusAccessUnit
+		}
+
+		au := &OpusAccessUnit{}
+		counter.Next()
+		au.StartTrimFlag = b[counter.Current()]&0x10 != 0
+		au.EndTrimFlag = b[counter.Current()]&0x08 != 0
+		au.ControlExtensionFlag = b[counter.Next()]&0x04 != 0
+
+		size := 0
+		for {
+			if counter.Current() >= len(b) {
+				return nil, ErrInvalidOpusAccessUnit
+			}
+			next := b[counter.Next()]
+			size += int(next)
+			if next != 0xff {
+				break
+			}
+		}
+
+		if au.StartTrimFlag {
+			if counter.Current()+2 > len(b) {
+				return nil, ErrInvalidOpusAccessUnit
+			}
+			au.StartTrim = uint16(b[counter.Current()]&0x1f)<<8 | uint16(b[counter.Current()+1])
+			counter.Seek(2)
+		}
+		if au.EndTrimFlag {
+			if counter.Current()+2 > len(b) {
+				return nil, ErrInvalidOpusAccessUnit
+			}
+			au.EndTrim = uint16(b[counter.Current()]&0x1f)<<8 | uint16(b[counter.Current()+1])
+			counter.Seek(2)
+		}
+		if au.ControlExtensionFlag {
+			if counter.Current() >= len(b) || counter.Current()+1+int(b[counter.Current()]) > len(b) {
+				return nil, ErrInvalidOpusAccessUnit
+			}
+			length := int(b[counter.Next()])
+			au.ControlExtension = b[counter.Current() : counter.Current()+length]
+			counter.Seek(length)
+		}
+
+		if counter.Current()+size > len(b) {
+			return nil, ErrInvalidOpusAccessUnit
+		}
+		au.Data = b[counter.Current() : counter.Current()+size]
+		counter.Seek(size)
+
+		units = append(units, au)
+	}
+
+	return units, nil
+}
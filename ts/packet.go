@@ -31,6 +31,24 @@ func (p *Packet) GetPMT() (*PMT, error) {
 	return nil, errors.New("pmt not exists")
 }
 
+func (p *Packet) GetSDT() (*SDT, error) {
+	if p.Payload != nil && p.Payload.Type == PayloadPSI {
+		if p.Payload.PSI.SDT != nil {
+			return p.Payload.PSI.SDT, nil
+		}
+	}
+	return nil, errors.New("sdt not exists")
+}
+
+func (p *Packet) GetSpliceInfo() (*SpliceInfoSection, error) {
+	if p.Payload != nil && p.Payload.Type == PayloadPSI {
+		if p.Payload.PSI.SpliceInfo != nil {
+			return p.Payload.PSI.SpliceInfo, nil
+		}
+	}
+	return nil, errors.New("splice info not exists")
+}
+
 func (p *Packet) Encode() []byte {
 	headerOffset := 4
 
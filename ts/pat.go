@@ -34,6 +34,8 @@ func NewPAT() *PAT {
 }
 
 func (p *PAT) encode() []byte {
+	p.SectionLength = uint16(5 + 4*len(p.TableData) + 4)
+
 	buf := make([]byte, 3+p.SectionLength)
 	buf[0] = p.TableId
 
@@ -60,10 +62,19 @@ func (p *PAT) encode() []byte {
 	buf[6] = p.SectionNumber
 	buf[7] = p.LastSectionNumber
 
-	binary.BigEndian.PutUint16(buf[8:], p.TableData[0].ProgramNumber)
-	binary.BigEndian.PutUint16(buf[10:], ((uint16(0)|(uint16(p.TableData[0].Reserved)&0x7))<<13)|p.TableData[0].PID)
+	counter := NewCounterOffset[int](8)
+	for _, td := range p.TableData {
+		programNumber := td.ProgramNumber
+		if td.IsNetworkPID {
+			programNumber = 0
+		}
+		binary.BigEndian.PutUint16(buf[counter.Current():], programNumber)
+		counter.Seek(2)
+		binary.BigEndian.PutUint16(buf[counter.Current():], ((uint16(0)|(uint16(td.Reserved)&0x7))<<13)|td.PID)
+		counter.Seek(2)
+	}
 
-	binary.BigEndian.PutUint32(buf[12:], computeCRC32(buf[:12]))
+	binary.BigEndian.PutUint32(buf[counter.Current():], computeCRC32(buf[:counter.Current()]))
 
 	return buf
 }
@@ -1,6 +1,9 @@
 package ts
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"slices"
+)
 
 const (
 	PayloadPSI     = 1
@@ -34,7 +37,7 @@ func (p *Payload) Encode() []byte {
 
 func IsPES(p []byte) bool {
 	if len(p) > 4 {
-		return (binary.BigEndian.Uint32(p[0:4])>>8)&0x000001 != 0
+		return binary.BigEndian.Uint32(p[0:4])>>8 == 0x000001
 	}
 	return false
 }
@@ -49,6 +52,10 @@ func DecodePayload(parent *Packet, pid uint16, b []byte, onlyData bool) (*Payloa
 	if onlyData {
 		p.RawData = NewRawData(p, b)
 		p.Type = PayloadRawData
+	} else if !p.parent.Header.PayloadUntilStartIndicator && (slices.Contains(p.parent.container.scte35PIDs, pid) || p.parent.container.GetKLVMode(pid) != KLVNone) {
+		// continuation of a section or metadata PES spanning several packets
+		p.RawData = NewRawData(p, b)
+		p.Type = PayloadRawData
 	} else if IsPES(b) {
 		p.PES, err = DecodePES(p, b)
 		p.Type = PayloadPES
@@ -28,6 +28,8 @@ const (
 	ProgramStreamDirectory
 )
 
+const StreamIdPrivateStream1 uint8 = 0xbd
+
 var ErrInvalidPesStreamId = errors.New("invalid PES stream id")
 var ErrInvalidPesHeaderMark = errors.New("invalid PES header mark")
 
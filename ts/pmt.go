@@ -30,8 +30,14 @@ func NewPMT() *PMT {
 }
 
 func (p *PMT) encode() []byte {
+	programInfo := make([]byte, 0)
+	if p.ProgramInfo != nil {
+		programInfo = p.ProgramInfo.encode()
+	}
+	p.ProgramInfoLength = uint16(len(programInfo))
+
 	streams := make([][]byte, len(p.EsInfo.Streams))
-	fullLen := 3 + 13
+	fullLen := 3 + 13 + len(programInfo)
 
 	for i, stream := range p.EsInfo.Streams {
 		streams[i] = stream.encode()
@@ -80,8 +86,10 @@ func (p *PMT) encode() []byte {
 	next16part |= p.ProgramInfoLength
 	binary.BigEndian.PutUint16(buf[10:], next16part)
 
+	copy(buf[12:], programInfo)
+
 	//ES
-	counter := NewCounterOffset[int](12)
+	counter := NewCounterOffset[int](12 + len(programInfo))
 	for _, stream := range streams {
 		copy(buf[counter.Current():], stream)
 		counter.Seek(len(stream))
@@ -4,6 +4,15 @@ type ProgramInfo struct {
 	Descriptors []*Descriptor
 }
 
+func (p *ProgramInfo) encode() []byte {
+	buf := make([]byte, 0)
+	for _, d := range p.Descriptors {
+		buf = append(buf, d.encode()...)
+	}
+
+	return buf
+}
+
 func DecodeProgramInfo(b []byte) *ProgramInfo {
 	return &ProgramInfo{
 		Descriptors: DecodeDescriptors(b),
@@ -1,6 +1,10 @@
 package ts
 
-import "errors"
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+)
 
 var ErrUnsupportedPsiTable = errors.New("PSI support only PAT, PMT and Data table")
 
@@ -9,6 +13,8 @@ type PSI struct {
 	PointerFillerBytes uint8
 	PMT                *PMT
 	PAT                *PAT
+	SDT                *SDT
+	SpliceInfo         *SpliceInfoSection
 	parent             *Payload
 }
 
@@ -19,6 +25,10 @@ func (p *PSI) encode() []byte {
 		result = p.PAT.encode()
 	} else if p.PMT != nil {
 		result = p.PMT.encode()
+	} else if p.SDT != nil {
+		result = p.SDT.encode()
+	} else if p.SpliceInfo != nil {
+		result = p.SpliceInfo.encode()
 	}
 
 	res := make([]byte, len(result)+1)
@@ -27,6 +37,12 @@ func (p *PSI) encode() []byte {
 	return res
 }
 
+// isCompleteSection reports whether the section starting at b ends within
+// b, sections spanning several packets are not reassembled.
+func isCompleteSection(b []byte) bool {
+	return len(b) >= 3 && 3+int(binary.BigEndian.Uint16(b[1:3])&0x0fff) <= len(b)
+}
+
 func isPAT(pid uint16) bool {
 	return pid == 0x0000
 }
@@ -43,6 +59,10 @@ func isIPMP(pid uint16) bool {
 	return pid == 0x0003
 }
 
+func isSDT(pid uint16) bool {
+	return pid == SDTPid
+}
+
 func isReservedForFuture(pid uint16) bool {
 	return pid >= 0x0004 && pid <= 0x000f
 }
@@ -55,8 +75,10 @@ func isData(pid uint16) bool {
 	return (pid >= 0x0010 && pid <= 0x1ffe) && !isDigiCipher(pid)
 }
 
+const NullPID uint16 = 0x1fff
+
 func isNULL(pid uint16) bool {
-	return pid == 0x1fff
+	return pid == NullPID
 }
 
 func isDigiCipher(pid uint16) bool {
@@ -79,6 +101,11 @@ func DecodePSI(parent *Payload, payload []byte, pid uint16) (*PSI, error) {
 
 	if isPAT(pid) {
 		p.PAT = DecodePAT(data)
+	} else if isSDT(pid) {
+		// BAT shares the PID with SDT
+		if len(data) >= 15 && (data[0] == SDTTableIdActual || data[0] == SDTTableIdOther) {
+			p.SDT = DecodeSDT(data)
+		}
 	} else if isData(pid) {
 		isPMT := false
 
@@ -91,6 +118,11 @@ func DecodePSI(parent *Payload, payload []byte, pid uint16) (*PSI, error) {
 
 		if isPMT {
 			p.PMT = DecodePMT(data)
+		} else if slices.Contains(p.parent.parent.container.scte35PIDs, pid) && isCompleteSection(data) {
+			var err error
+			if p.SpliceInfo, err = DecodeSpliceInfoSection(data); err != nil {
+				return nil, err
+			}
 		}
 
 	} else {
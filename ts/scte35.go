@@ -0,0 +1,706 @@
+package ts
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const SpliceInfoTableId = 0xfc
+
+// FormatIdentifierCUEI registers SCTE-35 in the PMT program_info loop.
+const FormatIdentifierCUEI uint32 = 0x43554549
+
+const (
+	SpliceCommandNull                 = 0x00
+	SpliceCommandSchedule             = 0x04
+	SpliceCommandInsert               = 0x05
+	SpliceCommandTimeSignal           = 0x06
+	SpliceCommandBandwidthReservation = 0x07
+	SpliceCommandPrivate              = 0xff
+)
+
+const (
+	SpliceDescriptorTagAvail        = 0x00
+	SpliceDescriptorTagDTMF         = 0x01
+	SpliceDescriptorTagSegmentation = 0x02
+	SpliceDescriptorTagTime         = 0x03
+	SpliceDescriptorTagAudio        = 0x04
+)
+
+const (
+	SegmentationTypeProgramStart                         = 0x10
+	SegmentationTypeProgramEnd                           = 0x11
+	SegmentationTypeChapterStart                         = 0x20
+	SegmentationTypeChapterEnd                           = 0x21
+	SegmentationTypeBreakStart                           = 0x22
+	SegmentationTypeBreakEnd                             = 0x23
+	SegmentationTypeProviderAdvertisementStart           = 0x30
+	SegmentationTypeProviderAdvertisementEnd             = 0x31
+	SegmentationTypeDistributorAdvertisementStart        = 0x32
+	SegmentationTypeDistributorAdvertisementEnd          = 0x33
+	SegmentationTypeProviderPlacementOpportunityStart    = 0x34
+	SegmentationTypeProviderPlacementOpportunityEnd      = 0x35
+	SegmentationTypeDistributorPlacementOpportunityStart = 0x36
+	SegmentationTypeDistributorPlacementOpportunityEnd   = 0x37
+)
+
+var ErrInvalidSpliceInfo = errors.New("invalid splice info section")
+var ErrSpliceInfoCRC = errors.New("splice info section crc mismatch")
+
+// SpliceInfoSection is the SCTE-35 splice_info_section. Encrypted sections
+// are decoded up to the encrypted part only.
+type SpliceInfoSection struct {
+	TableId                uint8
+	SectionSyntaxIndicator bool
+	PrivateIndicator       bool
+	SAPType                uint8
+	SectionLength          uint16
+	ProtocolVersion        uint8
+	EncryptedPacket        bool
+	EncryptionAlgorithm    uint8
+	PtsAdjustment          uint64
+	CwIndex                uint8
+	Tier                   uint16
+	SpliceCommandLength    uint16
+	SpliceCommandType      uint8
+	SpliceInsert           *SpliceInsert
+	TimeSignal             *TimeSignal
+	// SpliceCommand holds the body of commands without a dedicated
+	// structure.
+	SpliceCommand        []byte
+	DescriptorLoopLength uint16
+	SpliceDescriptors    []*SpliceDescriptor
+	Crc32                uint32
+}
+
+type SpliceTime struct {
+	TimeSpecifiedFlag bool
+	PtsTime           uint64
+}
+
+type BreakDuration struct {
+	AutoReturn bool
+	Duration   uint64
+}
+
+type SpliceInsert struct {
+	SpliceEventId              uint32
+	SpliceEventCancelIndicator bool
+	OutOfNetworkIndicator      bool
+	ProgramSpliceFlag          bool
+	DurationFlag               bool
+	SpliceImmediateFlag        bool
+	EventIdComplianceFlag      bool
+	SpliceTime                 *SpliceTime
+	Components                 []*SpliceComponent
+	BreakDuration              *BreakDuration
+	UniqueProgramId            uint16
+	AvailNum                   uint8
+	AvailsExpected             uint8
+}
+
+type SpliceComponent struct {
+	ComponentTag uint8
+	SpliceTime   *SpliceTime
+}
+
+type TimeSignal struct {
+	SpliceTime *SpliceTime
+}
+
+type SpliceDescriptor struct {
+	SpliceDescriptorTag uint8
+	DescriptorLength    uint8
+	Identifier          uint32
+	*SegmentationDescriptor
+	// Data holds the body of descriptors without a dedicated structure.
+	Data []byte
+}
+
+type SegmentationDescriptor struct {
+	SegmentationEventId                    uint32
+	SegmentationEventCancelIndicator       bool
+	SegmentationEventIdComplianceIndicator bool
+	ProgramSegmentationFlag                bool
+	SegmentationDurationFlag               bool
+	DeliveryNotRestrictedFlag              bool
+	WebDeliveryAllowedFlag                 bool
+	NoRegionalBlackoutFlag                 bool
+	ArchiveAllowedFlag                     bool
+	DeviceRestrictions                     uint8
+	Components                             []*SegmentationComponent
+	SegmentationDuration                   uint64
+	SegmentationUpidType                   uint8
+	SegmentationUpid                       []byte
+	SegmentationTypeId                     uint8
+	SegmentNum                             uint8
+	SegmentsExpected                       uint8
+	SubSegmentNum                          uint8
+	SubSegmentsExpected                    uint8
+}
+
+type SegmentationComponent struct {
+	ComponentTag uint8
+	PtsOffset    uint64
+}
+
+// NewSpliceInfoSection returns a section with the given command, one of
+// *SpliceInsert, *TimeSignal or nil for splice_null.
+func NewSpliceInfoSection(command any, descriptors ...*SpliceDescriptor) *SpliceInfoSection {
+	s := &SpliceInfoSection{
+		TableId:           SpliceInfoTableId,
+		SAPType:           0x3,
+		Tier:              0xfff,
+		SpliceCommandType: SpliceCommandNull,
+		SpliceDescriptors: descriptors,
+	}
+
+	switch c := command.(type) {
+	case *SpliceInsert:
+		s.SpliceCommandType = SpliceCommandInsert
+		s.SpliceInsert = c
+	case *TimeSignal:
+		s.SpliceCommandType = SpliceCommandTimeSignal
+		s.TimeSignal = c
+	}
+
+	return s
+}
+
+func NewSegmentationDescriptor(segmentation *SegmentationDescriptor) *SpliceDescriptor {
+	return &SpliceDescriptor{
+		SpliceDescriptorTag:    SpliceDescriptorTagSegmentation,
+		Identifier:             FormatIdentifierCUEI,
+		SegmentationDescriptor: segmentation,
+	}
+}
+
+func (s *SpliceInfoSection) encode() []byte {
+	command := s.encodeCommand()
+	s.SpliceCommandLength = uint16(len(command))
+
+	descriptors := make([]byte, 0)
+	for _, d := range s.SpliceDescriptors {
+		descriptors = append(descriptors, d.encode()...)
+	}
+	s.DescriptorLoopLength = uint16(len(descriptors))
+
+	fullLen := 14 + len(command) + 2 + len(descriptors) + 4
+	s.SectionLength = uint16(fullLen - 3)
+
+	buf := make([]byte, fullLen)
+	buf[0] = s.TableId
+
+	next16part := uint16(0)
+	if s.SectionSyntaxIndicator {
+		next16part |= 0x8000
+	}
+	if s.PrivateIndicator {
+		next16part |= 0x4000
+	}
+	next16part |= (uint16(s.SAPType) & 0x3) << 12
+	next16part |= s.SectionLength & 0x0fff
+	binary.BigEndian.PutUint16(buf[1:], next16part)
+
+	buf[3] = s.ProtocolVersion
+
+	buf[4] = (s.EncryptionAlgorithm & 0x3f) << 1
+	if s.EncryptedPacket {
+		buf[4] |= 0x80
+	}
+	buf[4] |= uint8(s.PtsAdjustment>>32) & 0x1
+	binary.BigEndian.PutUint32(buf[5:], uint32(s.PtsAdjustment))
+
+	buf[9] = s.CwIndex
+
+	next32part := (uint32(s.Tier) & 0xfff) << 12
+	next32part |= uint32(s.SpliceCommandLength) & 0xfff
+	buf[10] = uint8(next32part >> 16)
+	buf[11] = uint8(next32part >> 8)
+	buf[12] = uint8(next32part)
+	buf[13] = s.SpliceCommandType
+
+	counter := NewCounterOffset[int](14)
+	copy(buf[counter.Current():], command)
+	counter.Seek(len(command))
+
+	binary.BigEndian.PutUint16(buf[counter.Current():], s.DescriptorLoopLength)
+	counter.Seek(2)
+	copy(buf[counter.Current():], descriptors)
+
+	binary.BigEndian.PutUint32(buf[fullLen-4:], computeCRC32(buf[:fullLen-4]))
+
+	return buf
+}
+
+func (s *SpliceInfoSection) encodeCommand() []byte {
+	switch {
+	case s.SpliceCommandType == SpliceCommandInsert && s.SpliceInsert != nil:
+		return s.SpliceInsert.encode()
+	case s.SpliceCommandType == SpliceCommandTimeSignal && s.TimeSignal != nil:
+		return s.TimeSignal.SpliceTime.encode()
+	}
+
+	return s.SpliceCommand
+}
+
+func (t *SpliceTime) encode() []byte {
+	if t == nil || !t.TimeSpecifiedFlag {
+		return []byte{0x7f}
+	}
+
+	buf := make([]byte, 5)
+	buf[0] = 0xfe | uint8(t.PtsTime>>32)&0x1
+	binary.BigEndian.PutUint32(buf[1:], uint32(t.PtsTime))
+
+	return buf
+}
+
+func (d *BreakDuration) encode() []byte {
+	if d == nil {
+		d = &BreakDuration{}
+	}
+
+	buf := make([]byte, 5)
+	buf[0] = 0x7e | uint8(d.Duration>>32)&0x1
+	if d.AutoReturn {
+		buf[0] |= 0x80
+	}
+	binary.BigEndian.PutUint32(buf[1:], uint32(d.Duration))
+
+	return buf
+}
+
+func (si *SpliceInsert) encode() []byte {
+	buf := make([]byte, 5, 20)
+	binary.BigEndian.PutUint32(buf, si.SpliceEventId)
+	buf[4] = 0x7f
+	if si.SpliceEventCancelIndicator {
+		buf[4] |= 0x80
+		return buf
+	}
+
+	flags := uint8(0x07)
+	if si.OutOfNetworkIndicator {
+		flags |= 0x80
+	}
+	if si.ProgramSpliceFlag {
+		flags |= 0x40
+	}
+	if si.DurationFlag {
+		flags |= 0x20
+	}
+	if si.SpliceImmediateFlag {
+		flags |= 0x10
+	}
+	if si.EventIdComplianceFlag {
+		flags |= 0x08
+	}
+	buf = append(buf, flags)
+
+	if si.ProgramSpliceFlag && !si.SpliceImmediateFlag {
+		buf = append(buf, si.SpliceTime.encode()...)
+	}
+
+	if !si.ProgramSpliceFlag {
+		buf = append(buf, uint8(len(si.Components)))
+		for _, c := range si.Components {
+			buf = append(buf, c.ComponentTag)
+			if !si.SpliceImmediateFlag {
+				buf = append(buf, c.SpliceTime.encode()...)
+			}
+		}
+	}
+
+	if si.DurationFlag {
+		buf = append(buf, si.BreakDuration.encode()...)
+	}
+
+	buf = binary.BigEndian.AppendUint16(buf, si.UniqueProgramId)
+	buf = append(buf, si.AvailNum, si.AvailsExpected)
+
+	return buf
+}
+
+func (d *SpliceDescriptor) encode() []byte {
+	body := d.encodeBody()
+	d.DescriptorLength = uint8(4 + len(body))
+
+	buf := make([]byte, 6+len(body))
+	buf[0] = d.SpliceDescriptorTag
+	buf[1] = d.DescriptorLength
+	binary.BigEndian.PutUint32(buf[2:], d.Identifier)
+	copy(buf[6:], body)
+
+	return buf
+}
+
+func (d *SpliceDescriptor) encodeBody() []byte {
+	if d.SpliceDescriptorTag != SpliceDescriptorTagSegmentation || d.SegmentationDescriptor == nil {
+		return d.Data
+	}
+
+	sd := d.SegmentationDescriptor
+
+	buf := make([]byte, 5, 32)
+	binary.BigEndian.PutUint32(buf, sd.SegmentationEventId)
+	buf[4] = 0x3f
+	if sd.SegmentationEventCancelIndicator {
+		buf[4] |= 0x80
+	}
+	if sd.SegmentationEventIdComplianceIndicator {
+		buf[4] |= 0x40
+	}
+	if sd.SegmentationEventCancelIndicator {
+		return buf
+	}
+
+	flags := uint8(0)
+	if sd.ProgramSegmentationFlag {
+		flags |= 0x80
+	}
+	if sd.SegmentationDurationFlag {
+		flags |= 0x40
+	}
+	if sd.DeliveryNotRestrictedFlag {
+		flags |= 0x3f
+	} else {
+		if sd.WebDeliveryAllowedFlag {
+			flags |= 0x10
+		}
+		if sd.NoRegionalBlackoutFlag {
+			flags |= 0x08
+		}
+		if sd.ArchiveAllowedFlag {
+			flags |= 0x04
+		}
+		flags |= sd.DeviceRestrictions & 0x3
+	}
+	buf = append(buf, flags)
+
+	if !sd.ProgramSegmentationFlag {
+		buf = append(buf, uint8(len(sd.Components)))
+		for _, c := range sd.Components {
+			buf = append(buf, c.ComponentTag, 0xfe|uint8(c.PtsOffset>>32)&0x1)
+			buf = binary.BigEndian.AppendUint32(buf, uint32(c.PtsOffset))
+		}
+	}
+
+	if sd.SegmentationDurationFlag {
+		buf = append(buf, uint8(sd.SegmentationDuration>>32))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(sd.SegmentationDuration))
+	}
+
+	buf = append(buf, sd.SegmentationUpidType, uint8(len(sd.SegmentationUpid)))
+	buf = append(buf, sd.SegmentationUpid...)
+	buf = append(buf, sd.SegmentationTypeId, sd.SegmentNum, sd.SegmentsExpected)
+
+	if hasSubSegments(sd.SegmentationTypeId) {
+		buf = append(buf, sd.SubSegmentNum, sd.SubSegmentsExpected)
+	}
+
+	return buf
+}
+
+func hasSubSegments(segmentationTypeId uint8) bool {
+	switch segmentationTypeId {
+	case 0x34, 0x36, 0x38, 0x3a:
+		return true
+	}
+
+	return false
+}
+
+func DecodeSpliceInfoSection(b []byte) (*SpliceInfoSection, error) {
+	if len(b) < 3 {
+		return nil, ErrInvalidSpliceInfo
+	}
+
+	s := &SpliceInfoSection{}
+	s.TableId = b[0]
+
+	next16part := binary.BigEndian.Uint16(b[1:3])
+	s.SectionSyntaxIndicator = next16part&0x8000 != 0
+	s.PrivateIndicator = next16part&0x4000 != 0
+	s.SAPType = uint8(next16part>>12) & 0x3
+	s.SectionLength = next16part & 0x0fff
+
+	end := 3 + int(s.SectionLength)
+	if s.TableId != SpliceInfoTableId || end > len(b) || end < 20 {
+		return nil, ErrInvalidSpliceInfo
+	}
+
+	s.Crc32 = binary.BigEndian.Uint32(b[end-4 : end])
+	if computeCRC32(b[:end-4]) != s.Crc32 {
+		return nil, ErrSpliceInfoCRC
+	}
+
+	s.ProtocolVersion = b[3]
+	s.EncryptedPacket = b[4]&0x80 != 0
+	s.EncryptionAlgorithm = (b[4] >> 1) & 0x3f
+	s.PtsAdjustment = uint64(b[4]&0x1)<<32 | uint64(binary.BigEndian.Uint32(b[5:9]))
+	s.CwIndex = b[9]
+
+	next32part := uint32(b[10])<<16 | uint32(b[11])<<8 | uint32(b[12])
+	s.Tier = uint16(next32part >> 12)
+	s.SpliceCommandLength = uint16(next32part & 0xfff)
+	s.SpliceCommandType = b[13]
+
+	if s.EncryptedPacket {
+		return s, nil
+	}
+
+	// splice_command_length 0xfff is allowed for legacy splice_insert and
+	// time_signal whose length follows from the command
+	commandEnd := 14 + int(s.SpliceCommandLength)
+	if s.SpliceCommandLength == 0xfff {
+		commandEnd = end - 4
+	}
+	if commandEnd > end-4 {
+		return nil, ErrInvalidSpliceInfo
+	}
+
+	command := b[14:commandEnd]
+	n := len(command)
+
+	var err error
+	switch s.SpliceCommandType {
+	case SpliceCommandNull:
+		n = 0
+	case SpliceCommandInsert:
+		s.SpliceInsert, n, err = decodeSpliceInsert(command)
+	case SpliceCommandTimeSignal:
+		s.TimeSignal = &TimeSignal{}
+		s.TimeSignal.SpliceTime, n, err = decodeSpliceTime(command)
+	default:
+		s.SpliceCommand = command
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	counter := NewCounterOffset[int](14 + n)
+	if counter.Current()+2 > end-4 {
+		return nil, ErrInvalidSpliceInfo
+	}
+
+	s.DescriptorLoopLength = binary.BigEndian.Uint16(b[counter.Current():])
+	counter.Seek(2)
+
+	descriptorsEnd := counter.Current() + int(s.DescriptorLoopLength)
+	if descriptorsEnd > end-4 {
+		return nil, ErrInvalidSpliceInfo
+	}
+
+	s.SpliceDescriptors, err = decodeSpliceDescriptors(b[counter.Current():descriptorsEnd])
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func decodeSpliceTime(b []byte) (*SpliceTime, int, error) {
+	if len(b) < 1 {
+		return nil, 0, ErrInvalidSpliceInfo
+	}
+
+	t := &SpliceTime{}
+	t.TimeSpecifiedFlag = b[0]&0x80 != 0
+	if !t.TimeSpecifiedFlag {
+		return t, 1, nil
+	}
+
+	if len(b) < 5 {
+		return nil, 0, ErrInvalidSpliceInfo
+	}
+	t.PtsTime = uint64(b[0]&0x1)<<32 | uint64(binary.BigEndian.Uint32(b[1:5]))
+
+	return t, 5, nil
+}
+
+func decodeSpliceInsert(b []byte) (*SpliceInsert, int, error) {
+	if len(b) < 5 {
+		return nil, 0, ErrInvalidSpliceInfo
+	}
+
+	si := &SpliceInsert{}
+	si.SpliceEventId = binary.BigEndian.Uint32(b)
+	si.SpliceEventCancelIndicator = b[4]&0x80 != 0
+	if si.SpliceEventCancelIndicator {
+		return si, 5, nil
+	}
+
+	if len(b) < 6 {
+		return nil, 0, ErrInvalidSpliceInfo
+	}
+	si.OutOfNetworkIndicator = b[5]&0x80 != 0
+	si.ProgramSpliceFlag = b[5]&0x40 != 0
+	si.DurationFlag = b[5]&0x20 != 0
+	si.SpliceImmediateFlag = b[5]&0x10 != 0
+	si.EventIdComplianceFlag = b[5]&0x08 != 0
+
+	counter := NewCounterOffset[int](6)
+
+	if si.ProgramSpliceFlag && !si.SpliceImmediateFlag {
+		t, n, err := decodeSpliceTime(b[counter.Current():])
+		if err != nil {
+			return nil, 0, err
+		}
+		si.SpliceTime = t
+		counter.Seek(n)
+	}
+
+	if !si.ProgramSpliceFlag {
+		if counter.Current() >= len(b) {
+			return nil, 0, ErrInvalidSpliceInfo
+		}
+		componentCount := int(b[counter.Next()])
+		for i := 0; i < componentCount; i++ {
+			if counter.Current() >= len(b) {
+				return nil, 0, ErrInvalidSpliceInfo
+			}
+			c := &SpliceComponent{ComponentTag: b[counter.Next()]}
+			if !si.SpliceImmediateFlag {
+				t, n, err := decodeSpliceTime(b[counter.Current():])
+				if err != nil {
+					return nil, 0, err
+				}
+				c.SpliceTime = t
+				counter.Seek(n)
+			}
+			si.Components = append(si.Components, c)
+		}
+	}
+
+	if si.DurationFlag {
+		if counter.Current()+5 > len(b) {
+			return nil, 0, ErrInvalidSpliceInfo
+		}
+		si.BreakDuration = &BreakDuration{
+			AutoReturn: b[counter.Current()]&0x80 != 0,
+			Duration:   uint64(b[counter.Current()]&0x1)<<32 | uint64(binary.BigEndian.Uint32(b[counter.Current()+1:])),
+		}
+		counter.Seek(5)
+	}
+
+	if counter.Current()+4 > len(b) {
+		return nil, 0, ErrInvalidSpliceInfo
+	}
+	si.UniqueProgramId = binary.BigEndian.Uint16(b[counter.Current():])
+	counter.Seek(2)
+	si.AvailNum = b[counter.Next()]
+	si.AvailsExpected = b[counter.Next()]
+
+	return si, counter.Current(), nil
+}
+
+func decodeSpliceDescriptors(b []byte) ([]*SpliceDescriptor, error) {
+	descriptors := make([]*SpliceDescriptor, 0)
+
+	counter := NewCounter[int]()
+	for counter.Current()+2 <= len(b) {
+		d := &SpliceDescriptor{}
+		d.SpliceDescriptorTag = b[counter.Next()]
+		d.DescriptorLength = b[counter.Next()]
+
+		if d.DescriptorLength < 4 || counter.Current()+int(d.DescriptorLength) > len(b) {
+			return nil, ErrInvalidSpliceInfo
+		}
+		d.Identifier = binary.BigEndian.Uint32(b[counter.Current():])
+		body := b[counter.Current()+4 : counter.Current()+int(d.DescriptorLength)]
+		counter.Seek(int(d.DescriptorLength))
+
+		if d.SpliceDescriptorTag == SpliceDescriptorTagSegmentation && d.Identifier == FormatIdentifierCUEI {
+			sd, err := decodeSegmentationDescriptor(body)
+			if err != nil {
+				return nil, err
+			}
+			d.SegmentationDescriptor = sd
+		} else {
+			d.Data = body
+		}
+
+		descriptors = append(descriptors, d)
+	}
+
+	return descriptors, nil
+}
+
+func decodeSegmentationDescriptor(b []byte) (*SegmentationDescriptor, error) {
+	if len(b) < 5 {
+		return nil, ErrInvalidSpliceInfo
+	}
+
+	sd := &SegmentationDescriptor{}
+	sd.SegmentationEventId = binary.BigEndian.Uint32(b)
+	sd.SegmentationEventCancelIndicator = b[4]&0x80 != 0
+	sd.SegmentationEventIdComplianceIndicator = b[4]&0x40 != 0
+	if sd.SegmentationEventCancelIndicator {
+		return sd, nil
+	}
+
+	if len(b) < 6 {
+		return nil, ErrInvalidSpliceInfo
+	}
+	sd.ProgramSegmentationFlag = b[5]&0x80 != 0
+	sd.SegmentationDurationFlag = b[5]&0x40 != 0
+	sd.DeliveryNotRestrictedFlag = b[5]&0x20 != 0
+	if !sd.DeliveryNotRestrictedFlag {
+		sd.WebDeliveryAllowedFlag = b[5]&0x10 != 0
+		sd.NoRegionalBlackoutFlag = b[5]&0x08 != 0
+		sd.ArchiveAllowedFlag = b[5]&0x04 != 0
+		sd.DeviceRestrictions = b[5] & 0x3
+	}
+
+	counter := NewCounterOffset[int](6)
+
+	if !sd.ProgramSegmentationFlag {
+		if counter.Current() >= len(b) {
+			return nil, ErrInvalidSpliceInfo
+		}
+		componentCount := int(b[counter.Next()])
+		if counter.Current()+6*componentCount > len(b) {
+			return nil, ErrInvalidSpliceInfo
+		}
+		for i := 0; i < componentCount; i++ {
+			sd.Components = append(sd.Components, &SegmentationComponent{
+				ComponentTag: b[counter.Current()],
+				PtsOffset:    uint64(b[counter.Current()+1]&0x1)<<32 | uint64(binary.BigEndian.Uint32(b[counter.Current()+2:])),
+			})
+			counter.Seek(6)
+		}
+	}
+
+	if sd.SegmentationDurationFlag {
+		if counter.Current()+5 > len(b) {
+			return nil, ErrInvalidSpliceInfo
+		}
+		sd.SegmentationDuration = uint64(b[counter.Current()])<<32 | uint64(binary.BigEndian.Uint32(b[counter.Current()+1:]))
+		counter.Seek(5)
+	}
+
+	if counter.Current()+2 > len(b) {
+		return nil, ErrInvalidSpliceInfo
+	}
+	sd.SegmentationUpidType = b[counter.Next()]
+	upidLength := int(b[counter.Next()])
+
+	if counter.Current()+upidLength+3 > len(b) {
+		return nil, ErrInvalidSpliceInfo
+	}
+	sd.SegmentationUpid = b[counter.Current() : counter.Current()+upidLength]
+	counter.Seek(upidLength)
+
+	sd.SegmentationTypeId = b[counter.Next()]
+	sd.SegmentNum = b[counter.Next()]
+	sd.SegmentsExpected = b[counter.Next()]
+
+	// sub segments were added in a later revision, older cues lack them
+	if hasSubSegments(sd.SegmentationTypeId) && counter.Current()+2 <= len(b) {
+		sd.SubSegmentNum = b[counter.Next()]
+		sd.SubSegmentsExpected = b[counter.Next()]
+	}
+
+	return sd, nil
+}
@@ -0,0 +1,177 @@
+package ts
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+)
+
+// Sample sections of SCTE 35 2019 chapter 14.
+const (
+	sampleTimeSignalStart = "/DA0AAAAAAAA///wBQb+cr0AUAAeAhxDVUVJSAAAjn/PAAGlmbAICAAAAAAsoKGKNAIAmsnRfg=="
+	sampleSpliceInsert    = "/DAvAAAAAAAA///wFAVIAACPf+/+c2nALv4AUsz1AAAAAAAKAAhDVUVJAAABNWLbowo="
+	sampleTimeSignalEnd   = "/DAvAAAAAAAA///wBQb+dGKQoAAZAhdDVUVJSAAAjn+fCAgAAAAALKChijUCAKnMZ1g="
+)
+
+func decodeSample(t *testing.T, sample string) ([]byte, *SpliceInfoSection) {
+	t.Helper()
+
+	b, err := base64.StdEncoding.DecodeString(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := DecodeSpliceInfoSection(b)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	return b, s
+}
+
+func TestSpliceInfoSectionSamplesRoundTrip(t *testing.T) {
+	for _, sample := range []string{sampleSpliceInsert, sampleTimeSignalEnd} {
+		b, s := decodeSample(t, sample)
+
+		if encoded := s.encode(); !bytes.Equal(encoded, b) {
+			t.Errorf("encode %s:\n got % x\nwant % x", sample, encoded, b)
+		}
+	}
+}
+
+// The placement opportunity start sample predates sub_segment_num and
+// sub_segments_expected, encoding adds them as zero.
+func TestSpliceInfoSectionLegacySubSegments(t *testing.T) {
+	b, s := decodeSample(t, sampleTimeSignalStart)
+
+	// section_length, descriptor_loop_length and descriptor_length grow by
+	// two bytes
+	want := bytes.Clone(b[:len(b)-4])
+	want[2] += 2
+	want[20] += 2
+	want[22] += 2
+	want = append(want, 0, 0)
+	want = binary.BigEndian.AppendUint32(want, computeCRC32(want))
+
+	if encoded := s.encode(); !bytes.Equal(encoded, want) {
+		t.Errorf("encode:\n got % x\nwant % x", encoded, want)
+	}
+
+	decoded, err := DecodeSpliceInfoSection(want)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if sd := decoded.SpliceDescriptors[0].SegmentationDescriptor; sd.SegmentNum != 2 || sd.SubSegmentNum != 0 || sd.SubSegmentsExpected != 0 {
+		t.Errorf("segmentation descriptor %+v", sd)
+	}
+}
+
+func TestDecodeSpliceInsertSample(t *testing.T) {
+	_, s := decodeSample(t, sampleSpliceInsert)
+
+	if s.SpliceCommandType != SpliceCommandInsert || s.SpliceInsert == nil {
+		t.Fatalf("command type %#x", s.SpliceCommandType)
+	}
+
+	si := s.SpliceInsert
+	if si.SpliceEventId != 0x4800008f || !si.OutOfNetworkIndicator || !si.ProgramSpliceFlag || !si.DurationFlag || si.SpliceImmediateFlag {
+		t.Errorf("splice insert %+v", si)
+	}
+	if si.SpliceTime == nil || !si.SpliceTime.TimeSpecifiedFlag || si.SpliceTime.PtsTime != 0x07369c02e {
+		t.Errorf("splice time %+v", si.SpliceTime)
+	}
+	if si.BreakDuration == nil || !si.BreakDuration.AutoReturn || si.BreakDuration.Duration != 0x00052ccf5 {
+		t.Errorf("break duration %+v", si.BreakDuration)
+	}
+
+	if len(s.SpliceDescriptors) != 1 {
+		t.Fatalf("%d descriptors", len(s.SpliceDescriptors))
+	}
+	d := s.SpliceDescriptors[0]
+	if d.SpliceDescriptorTag != SpliceDescriptorTagAvail || d.Identifier != FormatIdentifierCUEI || !bytes.Equal(d.Data, []byte{0, 0, 1, 0x35}) {
+		t.Errorf("avail descriptor %+v", d)
+	}
+}
+
+func TestDecodeTimeSignalSample(t *testing.T) {
+	_, s := decodeSample(t, sampleTimeSignalStart)
+
+	if s.TimeSignal == nil || s.TimeSignal.SpliceTime == nil || s.TimeSignal.SpliceTime.PtsTime != 0x072bd0050 {
+		t.Fatalf("time signal %+v", s.TimeSignal)
+	}
+
+	if len(s.SpliceDescriptors) != 1 || s.SpliceDescriptors[0].SegmentationDescriptor == nil {
+		t.Fatalf("descriptors %+v", s.SpliceDescriptors)
+	}
+
+	sd := s.SpliceDescriptors[0].SegmentationDescriptor
+	if sd.SegmentationEventId != 0x4800008e || !sd.ProgramSegmentationFlag || !sd.SegmentationDurationFlag ||
+		sd.SegmentationDuration != 0x0001a599b0 || sd.SegmentationTypeId != SegmentationTypeProviderPlacementOpportunityStart ||
+		sd.SegmentationUpidType != 0x08 || !bytes.Equal(sd.SegmentationUpid, []byte{0, 0, 0, 0, 0x2c, 0xa0, 0xa1, 0x8a}) ||
+		sd.SegmentNum != 2 || sd.SegmentsExpected != 0 {
+		t.Errorf("segmentation descriptor %+v", sd)
+	}
+}
+
+func TestSpliceInfoSectionRoundTrip(t *testing.T) {
+	s := NewSpliceInfoSection(&SpliceInsert{
+		SpliceEventId:         7,
+		OutOfNetworkIndicator: true,
+		DurationFlag:          true,
+		Components: []*SpliceComponent{
+			{ComponentTag: 1, SpliceTime: &SpliceTime{TimeSpecifiedFlag: true, PtsTime: 0x1ffffffff}},
+			{ComponentTag: 2},
+		},
+		BreakDuration:   &BreakDuration{AutoReturn: true, Duration: 30 * 90000},
+		UniqueProgramId: 42,
+		AvailNum:        1,
+		AvailsExpected:  2,
+	}, NewSegmentationDescriptor(&SegmentationDescriptor{
+		SegmentationEventId:    9,
+		WebDeliveryAllowedFlag: true,
+		ArchiveAllowedFlag:     true,
+		DeviceRestrictions:     2,
+		Components:             []*SegmentationComponent{{ComponentTag: 1, PtsOffset: 1234}},
+		SegmentationUpidType:   0x09,
+		SegmentationUpid:       []byte("SIGNAL:abc"),
+		SegmentationTypeId:     SegmentationTypeDistributorPlacementOpportunityStart,
+		SegmentNum:             1,
+		SegmentsExpected:       3,
+		SubSegmentNum:          4,
+		SubSegmentsExpected:    5,
+	}))
+	s.PtsAdjustment = 0x100000000
+
+	b := s.encode()
+	decoded, err := DecodeSpliceInfoSection(b)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if encoded := decoded.encode(); !bytes.Equal(encoded, b) {
+		t.Errorf("re-encode:\n got % x\nwant % x", encoded, b)
+	}
+
+	si := decoded.SpliceInsert
+	if decoded.PtsAdjustment != 0x100000000 || si == nil || si.ProgramSpliceFlag || len(si.Components) != 2 ||
+		si.Components[0].SpliceTime.PtsTime != 0x1ffffffff || si.Components[1].SpliceTime.TimeSpecifiedFlag ||
+		si.BreakDuration.Duration != 30*90000 || si.UniqueProgramId != 42 {
+		t.Errorf("splice insert %+v", si)
+	}
+
+	sd := decoded.SpliceDescriptors[0].SegmentationDescriptor
+	if sd == nil || sd.DeliveryNotRestrictedFlag || !sd.WebDeliveryAllowedFlag || sd.NoRegionalBlackoutFlag || sd.DeviceRestrictions != 2 ||
+		string(sd.SegmentationUpid) != "SIGNAL:abc" || sd.SubSegmentNum != 4 || sd.SubSegmentsExpected != 5 {
+		t.Errorf("segmentation descriptor %+v", sd)
+	}
+}
+
+func TestDecodeSpliceInfoSectionCRC(t *testing.T) {
+	b, _ := decodeSample(t, sampleSpliceInsert)
+	b[len(b)-1] ^= 0xff
+
+	if _, err := DecodeSpliceInfoSection(b); err != ErrSpliceInfoCRC {
+		t.Errorf("got %v, want %v", err, ErrSpliceInfoCRC)
+	}
+}
@@ -0,0 +1,178 @@
+package ts
+
+import "encoding/binary"
+
+const SDTPid uint16 = 0x0011
+
+const (
+	SDTTableIdActual = 0x42
+	SDTTableIdOther  = 0x46
+)
+
+const (
+	RunningStatusUndefined  = 0
+	RunningStatusNotRunning = 1
+	RunningStatusStarting   = 2
+	RunningStatusPausing    = 3
+	RunningStatusRunning    = 4
+	RunningStatusOffAir     = 5
+)
+
+type SDT struct {
+	TableId                uint8
+	SectionSyntaxIndicator bool
+	Reserved               uint8
+	SectionLength          uint16
+	TransportStreamId      uint16
+	Reserved2              uint8
+	VersionNumber          uint8
+	CurrentNextIndicator   bool
+	SectionNumber          uint8
+	LastSectionNumber      uint8
+	OriginalNetworkId      uint16
+	Reserved3              uint8
+	Services               []*SDTService
+	Crc32                  uint32
+}
+
+type SDTService struct {
+	ServiceId               uint16
+	Reserved                uint8
+	EITScheduleFlag         bool
+	EITPresentFollowingFlag bool
+	RunningStatus           uint8
+	FreeCAMode              bool
+	DescriptorsLoopLength   uint16
+	Descriptors             []*Descriptor
+}
+
+func NewSDT() *SDT {
+	return &SDT{
+		TableId: SDTTableIdActual,
+	}
+}
+
+func (s *SDT) encode() []byte {
+	services := make([][]byte, len(s.Services))
+	fullLen := 3 + 8 + 3 + 4
+	for i, service := range s.Services {
+		services[i] = service.encode()
+		fullLen += len(services[i])
+	}
+
+	s.SectionLength = uint16(fullLen - 3)
+
+	buf := make([]byte, fullLen)
+	buf[0] = s.TableId
+
+	next16part := uint16(0)
+	if s.SectionSyntaxIndicator {
+		next16part |= 0x8000
+	}
+	next16part |= (uint16(s.Reserved) & 0x7) << 12
+	next16part |= s.SectionLength & 0x0fff
+	binary.BigEndian.PutUint16(buf[1:], next16part)
+	binary.BigEndian.PutUint16(buf[3:], s.TransportStreamId)
+
+	next8part := (s.Reserved2 << 6) & 0xc0
+	next8part |= (s.VersionNumber << 1) & 0x3e
+	if s.CurrentNextIndicator {
+		next8part |= 0x1
+	}
+	buf[5] = next8part
+	buf[6] = s.SectionNumber
+	buf[7] = s.LastSectionNumber
+	binary.BigEndian.PutUint16(buf[8:], s.OriginalNetworkId)
+	buf[10] = s.Reserved3
+
+	counter := NewCounterOffset[int](11)
+	for _, service := range services {
+		copy(buf[counter.Current():], service)
+		counter.Seek(len(service))
+	}
+
+	binary.BigEndian.PutUint32(buf[fullLen-4:], computeCRC32(buf[:fullLen-4]))
+
+	return buf
+}
+
+func (s *SDTService) encode() []byte {
+	descriptors := make([]byte, 0)
+	for _, d := range s.Descriptors {
+		descriptors = append(descriptors, d.encode()...)
+	}
+	s.DescriptorsLoopLength = uint16(len(descriptors))
+
+	buf := make([]byte, 5+len(descriptors))
+	binary.BigEndian.PutUint16(buf, s.ServiceId)
+
+	buf[2] = (s.Reserved << 2) & 0xfc
+	if s.EITScheduleFlag {
+		buf[2] |= 0x2
+	}
+	if s.EITPresentFollowingFlag {
+		buf[2] |= 0x1
+	}
+
+	next16part := (uint16(s.RunningStatus) & 0x7) << 13
+	if s.FreeCAMode {
+		next16part |= 0x1000
+	}
+	next16part |= s.DescriptorsLoopLength & 0x0fff
+	binary.BigEndian.PutUint16(buf[3:], next16part)
+
+	copy(buf[5:], descriptors)
+
+	return buf
+}
+
+func DecodeSDT(b []byte) *SDT {
+	s := &SDT{}
+	s.TableId = b[0]
+
+	next16part := binary.BigEndian.Uint16(b[1:3])
+	s.SectionSyntaxIndicator = next16part>>15 == 0x1
+	s.Reserved = uint8((next16part >> 12) & 0x7)
+	s.SectionLength = next16part & 0x0fff
+	s.TransportStreamId = binary.BigEndian.Uint16(b[3:5])
+
+	s.Reserved2 = b[5] >> 6
+	s.VersionNumber = (b[5] >> 1) & 0x1f
+	s.CurrentNextIndicator = b[5]&0x1 != 0
+	s.SectionNumber = b[6]
+	s.LastSectionNumber = b[7]
+	s.OriginalNetworkId = binary.BigEndian.Uint16(b[8:10])
+	s.Reserved3 = b[10]
+
+	end := min(3+int(s.SectionLength), len(b))
+	if end < 15 {
+		return s
+	}
+
+	counter := NewCounterOffset[int](11)
+	for counter.Current()+5 <= end-4 {
+		service := &SDTService{}
+		service.ServiceId = binary.BigEndian.Uint16(b[counter.Current():])
+		counter.Seek(2)
+		service.Reserved = b[counter.Current()] >> 2
+		service.EITScheduleFlag = b[counter.Current()]&0x2 != 0
+		service.EITPresentFollowingFlag = b[counter.Current()]&0x1 != 0
+		counter.Next()
+
+		next16part = binary.BigEndian.Uint16(b[counter.Current():])
+		service.RunningStatus = uint8(next16part >> 13)
+		service.FreeCAMode = next16part&0x1000 != 0
+		service.DescriptorsLoopLength = next16part & 0x0fff
+		counter.Seek(2)
+
+		descriptorsEnd := min(counter.Current()+int(service.DescriptorsLoopLength), end-4)
+		service.Descriptors = DecodeDescriptors(b[counter.Current():descriptorsEnd])
+		counter.Seek(int(service.DescriptorsLoopLength))
+
+		s.Services = append(s.Services, service)
+	}
+
+	s.Crc32 = binary.BigEndian.Uint32(b[end-4 : end])
+
+	return s
+}
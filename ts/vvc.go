@@ -0,0 +1,106 @@
+package ts
+
+import "encoding/binary"
+
+const DescriptorTagVVCVideo = 57
+
+// VVCVideoDescriptor describes profile, tier and level of a VVC stream, the
+// general_ prefix keeps its fields apart from AVCVideoDescriptor.
+type VVCVideoDescriptor struct {
+	GeneralProfileIdc         uint8
+	GeneralTierFlag           bool
+	GeneralSubProfileIdc      []uint32
+	ProgressiveSourceFlag     bool
+	InterlacedSourceFlag      bool
+	NonPackedConstraintFlag   bool
+	FrameOnlyConstraintFlag   bool
+	GeneralLevelIdc           uint8
+	TemporalLayerSubsetFlag   bool
+	VVCStillPresentFlag       bool
+	VVC24HrPicturePresentFlag bool
+	HDRWCGIdc                 uint8
+	VideoPropertiesTag        uint8
+	TemporalIdMin             uint8
+	TemporalIdMax             uint8
+}
+
+func NewVVCVideoDescriptor(vvc *VVCVideoDescriptor) *Descriptor {
+	return &Descriptor{
+		DescriptorTag:      DescriptorTagVVCVideo,
+		Type:               DescriptorTagVVCVideo,
+		VVCVideoDescriptor: vvc,
+	}
+}
+
+func (vvc *VVCVideoDescriptor) encode() []byte {
+	buf := make([]byte, 0, 7+4*len(vvc.GeneralSubProfileIdc))
+
+	b := vvc.GeneralProfileIdc << 1
+	if vvc.GeneralTierFlag {
+		b |= 1
+	}
+	buf = append(buf, b, uint8(len(vvc.GeneralSubProfileIdc)))
+	for _, idc := range vvc.GeneralSubProfileIdc {
+		buf = binary.BigEndian.AppendUint32(buf, idc)
+	}
+
+	b = 0x0f
+	for i, flag := range []bool{vvc.ProgressiveSourceFlag, vvc.InterlacedSourceFlag, vvc.NonPackedConstraintFlag, vvc.FrameOnlyConstraintFlag} {
+		if flag {
+			b |= 0x80 >> i
+		}
+	}
+	buf = append(buf, b, vvc.GeneralLevelIdc)
+
+	b = 0x1f
+	for i, flag := range []bool{vvc.TemporalLayerSubsetFlag, vvc.VVCStillPresentFlag, vvc.VVC24HrPicturePresentFlag} {
+		if flag {
+			b |= 0x80 >> i
+		}
+	}
+	buf = append(buf, b, vvc.HDRWCGIdc<<6|0x30|vvc.VideoPropertiesTag&0xf)
+
+	if vvc.TemporalLayerSubsetFlag {
+		buf = append(buf, 0xf8|vvc.TemporalIdMin&0x7, 0xf8|vvc.TemporalIdMax&0x7)
+	}
+
+	return buf
+}
+
+func decodeVVCVideoDescriptor(b []byte) *VVCVideoDescriptor {
+	if len(b) < 2 || len(b) < 6+4*int(b[1]) {
+		return nil
+	}
+
+	vvc := &VVCVideoDescriptor{
+		GeneralProfileIdc: b[0] >> 1,
+		GeneralTierFlag:   b[0]&1 != 0,
+	}
+
+	counter := NewCounterOffset(2)
+	for i := 0; i < int(b[1]); i++ {
+		vvc.GeneralSubProfileIdc = append(vvc.GeneralSubProfileIdc, binary.BigEndian.Uint32(b[counter.Current():]))
+		counter.Seek(4)
+	}
+
+	vvc.ProgressiveSourceFlag = b[counter.Current()]&0x80 != 0
+	vvc.InterlacedSourceFlag = b[counter.Current()]&0x40 != 0
+	vvc.NonPackedConstraintFlag = b[counter.Current()]&0x20 != 0
+	vvc.FrameOnlyConstraintFlag = b[counter.Next()]&0x10 != 0
+	vvc.GeneralLevelIdc = b[counter.Next()]
+	vvc.TemporalLayerSubsetFlag = b[counter.Current()]&0x80 != 0
+	vvc.VVCStillPresentFlag = b[counter.Current()]&0x40 != 0
+	vvc.VVC24HrPicturePresentFlag = b[counter.Next()]&0x20 != 0
+	vvc.HDRWCGIdc = b[counter.Current()] >> 6
+	vvc.VideoPropertiesTag = b[counter.Next()] & 0xf
+
+	if vvc.TemporalLayerSubsetFlag {
+		if counter.Current()+2 > len(b) {
+			return nil
+		}
+		vvc.TemporalIdMin = b[counter.Next()] & 0x7
+		vvc.TemporalIdMax = b[counter.Next()] & 0x7
+	}
+
+	return vvc
+}